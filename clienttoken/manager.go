@@ -0,0 +1,116 @@
+package clienttoken
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"tiktok-oauth2/tiktok"
+)
+
+// retryDelay is the wait before retrying a failed background renewal
+const retryDelay = 30 * time.Second
+
+// Token is an app-level access token obtained with the client credentials grant
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	// renewAt is when the token is replaced, renewBefore its expiry
+	renewAt time.Time
+}
+
+// ExpiresIn returns the remaining lifetime in seconds
+func (t Token) ExpiresIn(now time.Time) int64 {
+	return max(int64(t.ExpiresAt.Sub(now)/time.Second), 0)
+}
+
+// Manager fetches, caches and renews the client access token
+type Manager struct {
+	client      *tiktok.Client
+	renewBefore time.Duration
+	now         func() time.Time
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewManager creates a client token manager for the app of a TikTok client.
+// Tokens are renewed renewBefore their expiry, but no earlier than half their lifetime.
+func NewManager(client *tiktok.Client, renewBefore time.Duration) *Manager {
+	return &Manager{
+		client:      client,
+		renewBefore: renewBefore,
+		now:         time.Now,
+	}
+}
+
+// WithClock sets the time source for token expiry
+func (m *Manager) WithClock(now func() time.Time) *Manager {
+	m.now = now
+	return m
+}
+
+// Token returns the cached client token, fetching a new one if it is missing or about to expire
+func (m *Manager) Token(ctx context.Context) (*Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != nil && m.now().Before(m.token.renewAt) {
+		token := *m.token
+		return &token, nil
+	}
+
+	token, err := m.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.token = token
+
+	result := *token
+	return &result, nil
+}
+
+// Start renews the token proactively until the context is cancelled
+func (m *Manager) Start(ctx context.Context) {
+	for {
+		wait := retryDelay
+		if token, err := m.Token(ctx); err == nil {
+			wait = m.renewIn(token)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// renewIn returns the wait until a token is due for renewal
+func (m *Manager) renewIn(token *Token) time.Duration {
+	return max(token.renewAt.Sub(m.now()), time.Second)
+}
+
+// fetch requests a new client token; the tiktok client falls back to the secondary secret
+func (m *Manager) fetch(ctx context.Context) (*Token, error) {
+	token, err := m.client.ClientToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("client token request failed: %w", err)
+	}
+
+	// A renew_before as long as the token lives would refetch on every call,
+	// so renewal starts no earlier than half the lifetime TikTok returned
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	expiresAt := m.now().Add(lifetime)
+	return &Token{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		ExpiresAt:   expiresAt,
+		renewAt:     expiresAt.Add(-min(m.renewBefore, lifetime/2)),
+	}, nil
+}
@@ -0,0 +1,104 @@
+package clienttoken
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiktok-oauth2/tiktok"
+)
+
+// newTestManager returns a manager for a fake token endpoint issuing tokens
+// with the given lifetime, the clock it reads and the fetch counter
+func newTestManager(t *testing.T, lifetime, renewBefore time.Duration) (*Manager, *time.Time, *atomic.Int32) {
+	t.Helper()
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "clt.test",
+			"token_type":   "Bearer",
+			"expires_in":   int(lifetime / time.Second),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client := tiktok.NewClient(tiktok.Config{
+		ClientKey:     "ck",
+		ClientSecrets: func() []string { return []string{"secret"} },
+		Endpoints:     tiktok.Endpoints{TokenURL: server.URL},
+	})
+	now := time.Unix(1_700_000_000, 0)
+	m := NewManager(client, renewBefore).WithClock(func() time.Time { return now })
+	return m, &now, &fetches
+}
+
+func TestTokenRenewedBeforeExpiry(t *testing.T) {
+	m, now, fetches := newTestManager(t, 2*time.Hour, 10*time.Minute)
+	start := *now
+
+	token, err := m.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ExpiresIn(*now) != 7200 {
+		t.Errorf("ExpiresIn = %d, want 7200", token.ExpiresIn(*now))
+	}
+	if wait := m.renewIn(token); wait != 110*time.Minute {
+		t.Errorf("renewal scheduled in %s, want 1h50m", wait)
+	}
+
+	steps := []struct {
+		at      time.Duration
+		fetches int32
+	}{
+		{time.Hour, 1},
+		{109 * time.Minute, 1},
+		{110 * time.Minute, 2},
+		{111 * time.Minute, 2},
+	}
+	for _, step := range steps {
+		*now = start.Add(step.at)
+		if _, err := m.Token(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := fetches.Load(); got != step.fetches {
+			t.Errorf("after %s: %d fetches, want %d", step.at, got, step.fetches)
+		}
+	}
+}
+
+func TestRenewBeforeLongerThanLifetimeIsCapped(t *testing.T) {
+	m, now, fetches := newTestManager(t, 2*time.Hour, 3*time.Hour)
+	start := *now
+
+	token, err := m.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait := m.renewIn(token); wait != time.Hour {
+		t.Errorf("renewal scheduled in %s, want half the lifetime", wait)
+	}
+
+	for i := 0; i < 10; i++ {
+		*now = start.Add(time.Duration(i) * time.Minute)
+		if _, err := m.Token(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("%d fetches within the first hour, want 1", got)
+	}
+
+	*now = start.Add(time.Hour)
+	if _, err := m.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("%d fetches after half the lifetime, want 2", got)
+	}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultAppID is the ID of the app built from tiktok.client_key / tiktok.client_secret
+const DefaultAppID = "default"
+
+// App is a TikTok app (client key) served by this instance
+type App struct {
+	ID           string `yaml:"id" json:"id"`
+	ClientKey    string `yaml:"client_key" json:"client_key"`
+	ClientSecret string `yaml:"client_secret" json:"client_secret"`
+	RedirectURI  string `yaml:"redirect_uri" json:"redirect_uri"`
+	// Secret files are re-read when they change
+	ClientSecretFile string `yaml:"client_secret_file,omitempty" json:"client_secret_file,omitempty"`
+	// Secondary secret tried when TikTok rejects the primary one during a rotation
+	SecondaryClientSecret     string `yaml:"secondary_client_secret,omitempty" json:"secondary_client_secret,omitempty"`
+	SecondaryClientSecretFile string `yaml:"secondary_client_secret_file,omitempty" json:"secondary_client_secret_file,omitempty"`
+}
+
+// AppIDs returns the configured app IDs in sorted order
+func (cfg *Config) AppIDs() []string {
+	apps, _, _ := cfg.Apps()
+	return sortedKeys(apps)
+}
+
+// Apps builds the app registry keyed by app ID from the single-app settings and the
+// configured apps, and returns the app serving the routes without an /apps/{app} prefix
+func (cfg *Config) Apps() (map[string]*App, *App, error) {
+	apps := map[string]*App{}
+	var errs []error
+
+	tiktok := cfg.TikTok
+	hasSecret := tiktok.ClientSecret != "" || tiktok.ClientSecretFile != ""
+	if tiktok.ClientKey != "" || hasSecret {
+		if tiktok.ClientKey == "" || !hasSecret {
+			errs = append(errs, errors.New("tiktok.client_key and tiktok.client_secret (or client_secret_file) must be set together"))
+		}
+		apps[DefaultAppID] = &App{
+			ID:                        DefaultAppID,
+			ClientKey:                 tiktok.ClientKey,
+			ClientSecret:              tiktok.ClientSecret,
+			RedirectURI:               tiktok.RedirectURI,
+			ClientSecretFile:          tiktok.ClientSecretFile,
+			SecondaryClientSecret:     tiktok.SecondaryClientSecret,
+			SecondaryClientSecretFile: tiktok.SecondaryClientSecretFile,
+		}
+	}
+
+	for i := range tiktok.Apps {
+		app := tiktok.Apps[i]
+		if app.ID == "" {
+			errs = append(errs, fmt.Errorf("tiktok.apps[%d]: app without id", i))
+			continue
+		}
+		if app.ClientKey == "" || (app.ClientSecret == "" && app.ClientSecretFile == "") {
+			errs = append(errs, fmt.Errorf("tiktok.apps[%d]: app %q needs client_key and client_secret (or client_secret_file)", i, app.ID))
+		}
+		if app.RedirectURI == "" {
+			errs = append(errs, fmt.Errorf("tiktok.apps[%d]: app %q needs redirect_uri", i, app.ID))
+		}
+		if _, exists := apps[app.ID]; exists {
+			errs = append(errs, fmt.Errorf("tiktok.apps[%d]: duplicate app id %q", i, app.ID))
+			continue
+		}
+		apps[app.ID] = &app
+	}
+
+	if len(apps) == 0 {
+		errs = append(errs, errors.New("tiktok.client_key and tiktok.client_secret (or tiktok.apps) must be set"))
+		return apps, nil, errors.Join(errs...)
+	}
+
+	var defaultApp *App
+	if app, ok := apps[tiktok.DefaultApp]; ok {
+		defaultApp = app
+	} else if len(apps) == 1 {
+		for _, app := range apps {
+			defaultApp = app
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("tiktok.default_app %q is not a registered app", tiktok.DefaultApp))
+	}
+	return apps, defaultApp, errors.Join(errs...)
+}
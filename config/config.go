@@ -1,49 +1,46 @@
 package config
 
 import (
-	"log"
-	"os"
-
-	"github.com/joho/godotenv"
+	"net"
+	"net/url"
+	"strings"
 )
 
-var (
-	ClientKey    string
-	ClientSecret string
-	RedirectURI  string
-	ServerPort   string
-	Debug        bool
-	AuthURL      = "https://www.tiktok.com/v2/auth/authorize/"
-	TokenURL     = "https://open.tiktokapis.com/v2/oauth/token/"
-)
+// ReturnToOrigins returns the allowlisted return_to origins in normalized form
+func (c *Config) ReturnToOrigins() []string {
+	return normalizeOrigins(c.OAuth.ReturnToAllowlist)
+}
 
-func LoadConfig() {
-	// .env dosyasını yükle (varsa)
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+// Origin returns the normalized origin of an http(s) URL for comparisons:
+// lowercase scheme://host with the scheme's default port dropped, or "" if
+// the URL is not an absolute http(s) URL
+func Origin(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ""
 	}
-
-	ClientKey = getEnv("TIKTOK_CLIENT_KEY", "")
-	ClientSecret = getEnv("TIKTOK_CLIENT_SECRET", "")
-	RedirectURI = getEnv("TIKTOK_REDIRECT_URI", "http://localhost:8080/callback")
-	ServerPort = getEnv("SERVER_PORT", "8080")
-	Debug = getEnv("DEBUG", "false") == "true"
-
-	if ClientKey == "" || ClientSecret == "" {
-		log.Fatal("TIKTOK_CLIENT_KEY and TIKTOK_CLIENT_SECRET must be set")
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return ""
 	}
-}
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
 	}
-	return defaultValue
+	return scheme + "://" + host
 }
 
-// DebugLog prints debug message if DEBUG is enabled
-func DebugLog(format string, args ...interface{}) {
-	if Debug {
-		log.Printf("[DEBUG] "+format, args...)
+// originOf returns scheme://host of a URL, or "" if it cannot be parsed
+func originOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ""
 	}
+	return u.Scheme + "://" + u.Host
 }
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOrigin(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://App.Example.com/path?q=1", "https://app.example.com"},
+		{"HTTPS://app.example.com", "https://app.example.com"},
+		{"https://app.example.com:443", "https://app.example.com"},
+		{"http://app.example.com:80/", "http://app.example.com"},
+		{"http://app.example.com:443", "http://app.example.com:443"},
+		{"https://app.example.com:8443", "https://app.example.com:8443"},
+		{"http://[::1]:3000", "http://[::1]:3000"},
+		{"http://[::1]:80", "http://[::1]"},
+		{"ftp://app.example.com", ""},
+		{"app.example.com", ""},
+		{"/relative", ""},
+	}
+	for _, tt := range tests {
+		if got := Origin(tt.raw); got != tt.want {
+			t.Errorf("Origin(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCurrentSecretsReReadFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Defaults()
+	cfg.Session.SecretFile = filepath.Join(dir, "session_secret")
+	cfg.Tokens.EncryptionKeysFile = filepath.Join(dir, "token_encryption_keys")
+
+	write := func(path, value string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(cfg.Session.SecretFile, "first-session-secret")
+	write(cfg.Tokens.EncryptionKeysFile, "k1:a")
+	if got := cfg.CurrentSessionSecret(); got != "first-session-secret" {
+		t.Errorf("CurrentSessionSecret = %q", got)
+	}
+	if got := cfg.CurrentEncryptionKeys(); got != "k1:a" {
+		t.Errorf("CurrentEncryptionKeys = %q", got)
+	}
+
+	write(cfg.Session.SecretFile, "rotated-session-secret-value")
+	write(cfg.Tokens.EncryptionKeysFile, "k1:a,k2:bb")
+	if got := cfg.CurrentSessionSecret(); got != "rotated-session-secret-value" {
+		t.Errorf("CurrentSessionSecret after rotation = %q", got)
+	}
+	if got := cfg.CurrentEncryptionKeys(); got != "k1:a,k2:bb" {
+		t.Errorf("CurrentEncryptionKeys after rotation = %q", got)
+	}
+}
@@ -0,0 +1,682 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+
+	"tiktok-oauth2/logging"
+	"tiktok-oauth2/oidc"
+	"tiktok-oauth2/quota"
+	"tiktok-oauth2/tiktok"
+	"tiktok-oauth2/utils"
+)
+
+// Config is the full service configuration, loadable from YAML or JSON with env overrides
+type Config struct {
+	Server      ServerConfig      `yaml:"server" json:"server"`
+	TikTok      TikTokConfig      `yaml:"tiktok" json:"tiktok"`
+	OAuth       OAuthConfig       `yaml:"oauth" json:"oauth"`
+	Tokens      TokensConfig      `yaml:"tokens" json:"tokens"`
+	ClientToken ClientTokenConfig `yaml:"client_token" json:"client_token"`
+	Session     SessionConfig     `yaml:"session" json:"session"`
+	JWT         JWTConfig         `yaml:"jwt" json:"jwt"`
+	OIDC        OIDCConfig        `yaml:"oidc" json:"oidc"`
+	Upstream    UpstreamConfig    `yaml:"upstream" json:"upstream"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" json:"rate_limit"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port        string `yaml:"port" json:"port"`
+	Debug       bool   `yaml:"debug" json:"debug"`
+	AdminAPIKey string `yaml:"admin_api_key" json:"admin_api_key"`
+	// Re-read when the file changes
+	AdminAPIKeyFile string `yaml:"admin_api_key_file" json:"admin_api_key_file"`
+	PublicURL       string `yaml:"public_url" json:"public_url"`
+	// ShutdownTimeout is how long in-flight requests may finish after SIGTERM
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+	// LogLevel is debug, info, warn or error (debug forces debug); LogFormat is text or json
+	LogLevel  string `yaml:"log_level" json:"log_level"`
+	LogFormat string `yaml:"log_format" json:"log_format"`
+}
+
+// TikTokConfig holds the default app credentials, extra apps and TikTok endpoints
+type TikTokConfig struct {
+	ClientKey    string `yaml:"client_key" json:"client_key"`
+	ClientSecret string `yaml:"client_secret" json:"client_secret"`
+	RedirectURI  string `yaml:"redirect_uri" json:"redirect_uri"`
+	// Secret files are re-read when they change; the secondary secret is tried on invalid_client
+	ClientSecretFile          string `yaml:"client_secret_file" json:"client_secret_file"`
+	SecondaryClientSecret     string `yaml:"secondary_client_secret" json:"secondary_client_secret"`
+	SecondaryClientSecretFile string `yaml:"secondary_client_secret_file" json:"secondary_client_secret_file"`
+	Apps                      []App  `yaml:"apps" json:"apps"`
+	DefaultApp                string `yaml:"default_app" json:"default_app"`
+	AuthURL                   string `yaml:"auth_url" json:"auth_url"`
+	TokenURL                  string `yaml:"token_url" json:"token_url"`
+	RevokeURL                 string `yaml:"revoke_url" json:"revoke_url"`
+	UserInfoURL               string `yaml:"user_info_url" json:"user_info_url"`
+}
+
+// OAuthConfig configures the authorization flow
+type OAuthConfig struct {
+	StateTTL            Duration            `yaml:"state_ttl" json:"state_ttl"`
+	PKCEEnabled         bool                `yaml:"pkce_enabled" json:"pkce_enabled"`
+	ScopeProfiles       map[string][]string `yaml:"scope_profiles" json:"scope_profiles"`
+	DefaultScopeProfile string              `yaml:"default_scope_profile" json:"default_scope_profile"`
+	ReturnToAllowlist   []string            `yaml:"return_to_allowlist" json:"return_to_allowlist"`
+	TicketTTL           Duration            `yaml:"ticket_ttl" json:"ticket_ttl"`
+}
+
+// TokensConfig configures token storage and background refresh
+type TokensConfig struct {
+	Store          string `yaml:"store" json:"store"`
+	Path           string `yaml:"path" json:"path"`
+	EncryptionKeys string `yaml:"encryption_keys" json:"encryption_keys"`
+	// Re-read when the file changes; tokens are then re-encrypted with the new primary key
+	EncryptionKeysFile string            `yaml:"encryption_keys_file" json:"encryption_keys_file"`
+	EncryptionPrimary  string            `yaml:"encryption_primary" json:"encryption_primary"`
+	AutoRefresh        AutoRefreshConfig `yaml:"auto_refresh" json:"auto_refresh"`
+}
+
+// AutoRefreshConfig configures the background refresh scheduler
+type AutoRefreshConfig struct {
+	Enabled     bool     `yaml:"enabled" json:"enabled"`
+	Interval    Duration `yaml:"interval" json:"interval"`
+	Window      Duration `yaml:"window" json:"window"`
+	Jitter      Duration `yaml:"jitter" json:"jitter"`
+	Concurrency int      `yaml:"concurrency" json:"concurrency"`
+	MaxAttempts int      `yaml:"max_attempts" json:"max_attempts"`
+}
+
+// ClientTokenConfig configures the client credentials token manager
+type ClientTokenConfig struct {
+	RenewBefore Duration `yaml:"renew_before" json:"renew_before"`
+	Prefetch    bool     `yaml:"prefetch" json:"prefetch"`
+}
+
+// SessionConfig configures session mode
+type SessionConfig struct {
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Secret  string `yaml:"secret" json:"secret"`
+	// Re-read when the file changes; cookies signed with the previous secret stay valid
+	SecretFile   string   `yaml:"secret_file" json:"secret_file"`
+	TTL          Duration `yaml:"ttl" json:"ttl"`
+	CookieName   string   `yaml:"cookie_name" json:"cookie_name"`
+	CookieSecure bool     `yaml:"cookie_secure" json:"cookie_secure"`
+}
+
+// JWTConfig configures our own JWTs
+type JWTConfig struct {
+	Enabled bool     `yaml:"enabled" json:"enabled"`
+	Issuer  string   `yaml:"issuer" json:"issuer"`
+	TTL     Duration `yaml:"ttl" json:"ttl"`
+	// Audience is the aud of login JWTs; it tells them apart from OIDC access tokens
+	Audience       string `yaml:"audience" json:"audience"`
+	PrivateKeyFile string `yaml:"private_key_file" json:"private_key_file"`
+	KeyID          string `yaml:"key_id" json:"key_id"`
+}
+
+// OIDCConfig configures the OpenID Connect facade
+type OIDCConfig struct {
+	Clients []oidc.Client `yaml:"clients" json:"clients"`
+	CodeTTL Duration      `yaml:"code_ttl" json:"code_ttl"`
+}
+
+// UpstreamConfig configures calls to the TikTok API
+type UpstreamConfig struct {
+	Retry   RetryConfig   `yaml:"retry" json:"retry"`
+	Breaker BreakerConfig `yaml:"breaker" json:"breaker"`
+	Quota   QuotaConfig   `yaml:"quota" json:"quota"`
+	// Timeouts bound each TikTok operation including retries
+	Timeouts TimeoutsConfig `yaml:"timeouts" json:"timeouts"`
+}
+
+// TimeoutsConfig configures the per-operation timeouts of TikTok API calls
+type TimeoutsConfig struct {
+	ExchangeCode Duration `yaml:"exchange_code" json:"exchange_code"`
+	Refresh      Duration `yaml:"refresh" json:"refresh"`
+	Revoke       Duration `yaml:"revoke" json:"revoke"`
+	UserInfo     Duration `yaml:"user_info" json:"user_info"`
+	ClientToken  Duration `yaml:"client_token" json:"client_token"`
+}
+
+// Timeouts returns the timeouts for tiktok.Client
+func (t TimeoutsConfig) Timeouts() tiktok.Timeouts {
+	return tiktok.Timeouts{
+		ExchangeCode: t.ExchangeCode.Duration(),
+		Refresh:      t.Refresh.Duration(),
+		Revoke:       t.Revoke.Duration(),
+		UserInfo:     t.UserInfo.Duration(),
+		ClientToken:  t.ClientToken.Duration(),
+	}
+}
+
+// RetryConfig configures retries of transient TikTok API failures
+type RetryConfig struct {
+	MaxAttempts int      `yaml:"max_attempts" json:"max_attempts"`
+	BaseDelay   Duration `yaml:"base_delay" json:"base_delay"`
+	MaxDelay    Duration `yaml:"max_delay" json:"max_delay"`
+	// Deadline bounds all attempts of one call together
+	Deadline Duration `yaml:"deadline" json:"deadline"`
+}
+
+// Policy returns the retry policy for utils.HTTPClient
+func (r RetryConfig) Policy() utils.RetryPolicy {
+	return utils.RetryPolicy{
+		MaxAttempts: r.MaxAttempts,
+		BaseDelay:   r.BaseDelay.Duration(),
+		MaxDelay:    r.MaxDelay.Duration(),
+		Deadline:    r.Deadline.Duration(),
+	}
+}
+
+// BreakerConfig configures the circuit breaker of each TikTok endpoint
+type BreakerConfig struct {
+	FailureThreshold int      `yaml:"failure_threshold" json:"failure_threshold"`
+	OpenTimeout      Duration `yaml:"open_timeout" json:"open_timeout"`
+	HalfOpenRequests int      `yaml:"half_open_requests" json:"half_open_requests"`
+}
+
+// Policy returns the circuit breaker policy for utils.HTTPClient
+func (b BreakerConfig) Policy() utils.BreakerPolicy {
+	return utils.BreakerPolicy{
+		FailureThreshold: b.FailureThreshold,
+		OpenTimeout:      b.OpenTimeout.Duration(),
+		HalfOpenRequests: b.HalfOpenRequests,
+	}
+}
+
+// QuotaConfig configures the per-app quotas of TikTok endpoints (token, revoke, user_info).
+// Every app is accounted separately; calls that do not fit wait up to MaxWait.
+type QuotaConfig struct {
+	MaxWait   Duration              `yaml:"max_wait" json:"max_wait"`
+	Endpoints map[string]QuotaLimit `yaml:"endpoints" json:"endpoints"`
+}
+
+// QuotaLimit allows Requests calls in any sliding Window
+type QuotaLimit struct {
+	Requests int      `yaml:"requests" json:"requests"`
+	Window   Duration `yaml:"window" json:"window"`
+}
+
+// Limits returns the quotas for quota.NewTracker
+func (q QuotaConfig) Limits() map[string]quota.Limit {
+	limits := make(map[string]quota.Limit, len(q.Endpoints))
+	for endpoint, limit := range q.Endpoints {
+		limits[endpoint] = quota.Limit{Requests: limit.Requests, Window: limit.Window.Duration()}
+	}
+	return limits
+}
+
+// RateLimitConfig configures inbound rate limiting of the OAuth endpoints
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// TrustProxy takes the client IP from X-Forwarded-For; enable only behind a proxy that sets it.
+	// The rightmost hop not from a trusted proxy is used, entries left of it are client-controlled.
+	TrustProxy bool `yaml:"trust_proxy" json:"trust_proxy"`
+	// TrustedProxies are the IPs or CIDRs of the proxies in front of the service. Empty trusts
+	// only the direct peer, so the rightmost X-Forwarded-For entry is the client.
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies"`
+	// Routes maps route names (auth, callback, refresh, revoke, user) to their limits
+	Routes map[string]RouteLimit `yaml:"routes" json:"routes"`
+}
+
+// RouteLimit is the token bucket of a route: Requests every Per, up to Burst at once
+type RouteLimit struct {
+	Requests int      `yaml:"requests" json:"requests"`
+	Per      Duration `yaml:"per" json:"per"`
+	Burst    int      `yaml:"burst" json:"burst"`
+	// Key is what requests are counted by: ip (default), api_key or open_id
+	Key string `yaml:"key" json:"key"`
+}
+
+// Duration is a time.Duration written as "10m" in config files
+type Duration time.Duration
+
+// Duration returns the value as time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// MarshalText encodes the duration as a string like "10m0s"
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses a duration string like "10m"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Defaults returns the configuration used when nothing is set
+func Defaults() *Config {
+	retry := utils.DefaultRetryPolicy()
+	breaker := utils.DefaultBreakerPolicy()
+	return &Config{
+		Server: ServerConfig{
+			Port:            "8080",
+			ShutdownTimeout: Duration(30 * time.Second),
+			LogLevel:        "info",
+			LogFormat:       logging.FormatText,
+		},
+		TikTok: TikTokConfig{
+			RedirectURI: "http://localhost:8080/callback",
+			DefaultApp:  DefaultAppID,
+			AuthURL:     tiktok.DefaultAuthURL,
+			TokenURL:    tiktok.DefaultTokenURL,
+			RevokeURL:   tiktok.DefaultRevokeURL,
+			UserInfoURL: tiktok.DefaultUserInfoURL,
+		},
+		OAuth: OAuthConfig{
+			StateTTL:            Duration(10 * time.Minute),
+			ScopeProfiles:       defaultScopeProfiles(),
+			DefaultScopeProfile: "login",
+			TicketTTL:           Duration(time.Minute),
+		},
+		Tokens: TokensConfig{
+			Store: "memory",
+			Path:  "tokens.json",
+			AutoRefresh: AutoRefreshConfig{
+				Enabled:     true,
+				Interval:    Duration(time.Minute),
+				Window:      Duration(time.Hour),
+				Jitter:      Duration(5 * time.Minute),
+				Concurrency: 4,
+				MaxAttempts: 5,
+			},
+		},
+		ClientToken: ClientTokenConfig{
+			RenewBefore: Duration(10 * time.Minute),
+		},
+		Session: SessionConfig{
+			TTL:          Duration(24 * time.Hour),
+			CookieName:   "tiktok_session",
+			CookieSecure: true,
+		},
+		JWT: JWTConfig{
+			Issuer:   "tiktok-oauth2",
+			TTL:      Duration(time.Hour),
+			Audience: "tiktok-oauth2-login",
+		},
+		OIDC: OIDCConfig{
+			CodeTTL: Duration(time.Minute),
+		},
+		Upstream: UpstreamConfig{
+			Retry: RetryConfig{
+				MaxAttempts: retry.MaxAttempts,
+				BaseDelay:   Duration(retry.BaseDelay),
+				MaxDelay:    Duration(retry.MaxDelay),
+				Deadline:    Duration(retry.Deadline),
+			},
+			Breaker: BreakerConfig{
+				FailureThreshold: breaker.FailureThreshold,
+				OpenTimeout:      Duration(breaker.OpenTimeout),
+				HalfOpenRequests: breaker.HalfOpenRequests,
+			},
+			Quota: QuotaConfig{
+				MaxWait: Duration(2 * time.Second),
+				Endpoints: map[string]QuotaLimit{
+					tiktok.EndpointUserInfo: {Requests: 600, Window: Duration(time.Minute)},
+				},
+			},
+			Timeouts: TimeoutsConfig{
+				ExchangeCode: Duration(15 * time.Second),
+				Refresh:      Duration(15 * time.Second),
+				Revoke:       Duration(10 * time.Second),
+				UserInfo:     Duration(10 * time.Second),
+				ClientToken:  Duration(15 * time.Second),
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Routes: map[string]RouteLimit{
+				"auth":     {Requests: 20, Per: Duration(time.Minute), Key: RateLimitKeyIP},
+				"callback": {Requests: 20, Per: Duration(time.Minute), Key: RateLimitKeyIP},
+				"refresh":  {Requests: 10, Per: Duration(time.Minute), Key: RateLimitKeyIP},
+				"revoke":   {Requests: 10, Per: Duration(time.Minute), Key: RateLimitKeyIP},
+				"user":     {Requests: 60, Per: Duration(time.Minute), Key: RateLimitKeyOpenID},
+			},
+		},
+	}
+}
+
+// Load builds the configuration from defaults, an optional YAML or JSON file and
+// environment overrides, then validates it. An empty path falls back to CONFIG_FILE. The configuration is returned even when
+// it is invalid, so it can be inspected; the error lists every problem found.
+func Load(path string) (*Config, error) {
+	// .env dosyasını yükle (varsa)
+	if err := godotenv.Load(); err != nil {
+		slog.Info("No .env file found, using environment variables")
+	}
+
+	if path == "" {
+		path = getEnv("CONFIG_FILE", "")
+	}
+
+	cfg := Defaults()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	envErr := cfg.applyEnv()
+	return cfg, errors.Join(envErr, cfg.Validate())
+}
+
+// loadFile decodes a YAML or JSON file over the current values
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	default:
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		err = decoder.Decode(c)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides values with the environment variables that are set
+func (c *Config) applyEnv() error {
+	var env envReader
+
+	env.string("SERVER_PORT", &c.Server.Port)
+	env.bool("DEBUG", &c.Server.Debug)
+	env.string("ADMIN_API_KEY", &c.Server.AdminAPIKey)
+	env.string("ADMIN_API_KEY_FILE", &c.Server.AdminAPIKeyFile)
+	env.string("PUBLIC_URL", &c.Server.PublicURL)
+	env.duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	env.string("LOG_LEVEL", &c.Server.LogLevel)
+	env.string("LOG_FORMAT", &c.Server.LogFormat)
+
+	env.string("TIKTOK_CLIENT_KEY", &c.TikTok.ClientKey)
+	env.string("TIKTOK_CLIENT_SECRET", &c.TikTok.ClientSecret)
+	env.string("TIKTOK_CLIENT_SECRET_FILE", &c.TikTok.ClientSecretFile)
+	env.string("TIKTOK_CLIENT_SECRET_SECONDARY", &c.TikTok.SecondaryClientSecret)
+	env.string("TIKTOK_CLIENT_SECRET_SECONDARY_FILE", &c.TikTok.SecondaryClientSecretFile)
+	env.string("TIKTOK_REDIRECT_URI", &c.TikTok.RedirectURI)
+	env.string("DEFAULT_APP", &c.TikTok.DefaultApp)
+	env.string("TIKTOK_AUTH_URL", &c.TikTok.AuthURL)
+	env.string("TIKTOK_TOKEN_URL", &c.TikTok.TokenURL)
+	env.string("TIKTOK_REVOKE_URL", &c.TikTok.RevokeURL)
+	env.string("TIKTOK_USER_INFO_URL", &c.TikTok.UserInfoURL)
+	env.jsonFile("TIKTOK_APPS", "TIKTOK_APPS_FILE", &c.TikTok.Apps)
+
+	env.duration("STATE_TTL", &c.OAuth.StateTTL)
+	env.bool("PKCE_ENABLED", &c.OAuth.PKCEEnabled)
+	env.scopeProfiles("TIKTOK_SCOPE_PROFILES", &c.OAuth.ScopeProfiles)
+	env.string("TIKTOK_DEFAULT_SCOPE_PROFILE", &c.OAuth.DefaultScopeProfile)
+	env.list("RETURN_TO_ALLOWLIST", &c.OAuth.ReturnToAllowlist)
+	env.duration("TICKET_TTL", &c.OAuth.TicketTTL)
+
+	env.string("TOKEN_STORE", &c.Tokens.Store)
+	env.string("TOKEN_STORE_PATH", &c.Tokens.Path)
+	env.string("TOKEN_ENCRYPTION_KEYS", &c.Tokens.EncryptionKeys)
+	env.string("TOKEN_ENCRYPTION_KEYS_FILE", &c.Tokens.EncryptionKeysFile)
+	env.string("TOKEN_ENCRYPTION_PRIMARY", &c.Tokens.EncryptionPrimary)
+	env.bool("AUTO_REFRESH", &c.Tokens.AutoRefresh.Enabled)
+	env.duration("AUTO_REFRESH_INTERVAL", &c.Tokens.AutoRefresh.Interval)
+	env.duration("AUTO_REFRESH_WINDOW", &c.Tokens.AutoRefresh.Window)
+	env.duration("AUTO_REFRESH_JITTER", &c.Tokens.AutoRefresh.Jitter)
+	env.int("AUTO_REFRESH_CONCURRENCY", &c.Tokens.AutoRefresh.Concurrency)
+	env.int("AUTO_REFRESH_MAX_ATTEMPTS", &c.Tokens.AutoRefresh.MaxAttempts)
+
+	env.duration("CLIENT_TOKEN_RENEW_BEFORE", &c.ClientToken.RenewBefore)
+	env.bool("CLIENT_TOKEN_PREFETCH", &c.ClientToken.Prefetch)
+
+	env.bool("SESSION_MODE", &c.Session.Enabled)
+	env.string("SESSION_SECRET", &c.Session.Secret)
+	env.string("SESSION_SECRET_FILE", &c.Session.SecretFile)
+	env.duration("SESSION_TTL", &c.Session.TTL)
+	env.string("SESSION_COOKIE_NAME", &c.Session.CookieName)
+	env.bool("SESSION_COOKIE_SECURE", &c.Session.CookieSecure)
+
+	env.bool("JWT_ENABLED", &c.JWT.Enabled)
+	env.string("JWT_ISSUER", &c.JWT.Issuer)
+	env.duration("JWT_TTL", &c.JWT.TTL)
+	env.string("JWT_AUDIENCE", &c.JWT.Audience)
+	env.string("JWT_PRIVATE_KEY_FILE", &c.JWT.PrivateKeyFile)
+	env.string("JWT_KEY_ID", &c.JWT.KeyID)
+
+	env.jsonFile("OIDC_CLIENTS", "OIDC_CLIENTS_FILE", &c.OIDC.Clients)
+	env.duration("OIDC_CODE_TTL", &c.OIDC.CodeTTL)
+
+	env.int("UPSTREAM_RETRY_MAX_ATTEMPTS", &c.Upstream.Retry.MaxAttempts)
+	env.duration("UPSTREAM_RETRY_BASE_DELAY", &c.Upstream.Retry.BaseDelay)
+	env.duration("UPSTREAM_RETRY_MAX_DELAY", &c.Upstream.Retry.MaxDelay)
+	env.duration("UPSTREAM_RETRY_DEADLINE", &c.Upstream.Retry.Deadline)
+	env.int("UPSTREAM_BREAKER_FAILURE_THRESHOLD", &c.Upstream.Breaker.FailureThreshold)
+	env.duration("UPSTREAM_BREAKER_OPEN_TIMEOUT", &c.Upstream.Breaker.OpenTimeout)
+	env.int("UPSTREAM_BREAKER_HALF_OPEN_REQUESTS", &c.Upstream.Breaker.HalfOpenRequests)
+	env.duration("UPSTREAM_QUOTA_MAX_WAIT", &c.Upstream.Quota.MaxWait)
+	env.jsonFile("UPSTREAM_QUOTAS", "UPSTREAM_QUOTAS_FILE", &c.Upstream.Quota.Endpoints)
+	env.duration("UPSTREAM_TIMEOUT_EXCHANGE_CODE", &c.Upstream.Timeouts.ExchangeCode)
+	env.duration("UPSTREAM_TIMEOUT_REFRESH", &c.Upstream.Timeouts.Refresh)
+	env.duration("UPSTREAM_TIMEOUT_REVOKE", &c.Upstream.Timeouts.Revoke)
+	env.duration("UPSTREAM_TIMEOUT_USER_INFO", &c.Upstream.Timeouts.UserInfo)
+	env.duration("UPSTREAM_TIMEOUT_CLIENT_TOKEN", &c.Upstream.Timeouts.ClientToken)
+
+	env.bool("RATE_LIMIT_ENABLED", &c.RateLimit.Enabled)
+	env.bool("RATE_LIMIT_TRUST_PROXY", &c.RateLimit.TrustProxy)
+	env.list("RATE_LIMIT_TRUSTED_PROXIES", &c.RateLimit.TrustedProxies)
+	env.jsonFile("RATE_LIMITS", "RATE_LIMITS_FILE", &c.RateLimit.Routes)
+
+	return errors.Join(env.errs...)
+}
+
+// Endpoints returns the configured TikTok API endpoints
+func (c *Config) Endpoints() tiktok.Endpoints {
+	return tiktok.Endpoints{
+		AuthURL:     c.TikTok.AuthURL,
+		TokenURL:    c.TikTok.TokenURL,
+		RevokeURL:   c.TikTok.RevokeURL,
+		UserInfoURL: c.TikTok.UserInfoURL,
+	}
+}
+
+// Logging returns the logger options; debug mode forces the debug level
+func (c *Config) Logging() logging.Options {
+	level, _ := logging.ParseLevel(c.Server.LogLevel)
+	if c.Server.Debug {
+		level = slog.LevelDebug
+	}
+	return logging.Options{Level: level, Format: c.Server.LogFormat}
+}
+
+// EffectivePublicURL returns the public URL, defaulting to the origin of the default app's redirect URI
+func (c *Config) EffectivePublicURL() string {
+	if c.Server.PublicURL != "" {
+		return strings.TrimRight(c.Server.PublicURL, "/")
+	}
+	if _, app, err := c.Apps(); err == nil {
+		return originOf(app.RedirectURI)
+	}
+	return originOf(c.TikTok.RedirectURI)
+}
+
+// Redacted returns a copy with every secret masked, safe to print
+func (c *Config) Redacted() *Config {
+	copied := *c
+	copied.Server.AdminAPIKey = redact(c.Server.AdminAPIKey)
+	copied.TikTok.ClientSecret = redact(c.TikTok.ClientSecret)
+	copied.TikTok.SecondaryClientSecret = redact(c.TikTok.SecondaryClientSecret)
+	copied.Tokens.EncryptionKeys = redactKeyring(c.Tokens.EncryptionKeys)
+	copied.Session.Secret = redact(c.Session.Secret)
+
+	copied.TikTok.Apps = make([]App, len(c.TikTok.Apps))
+	for i, app := range c.TikTok.Apps {
+		app.ClientSecret = redact(app.ClientSecret)
+		app.SecondaryClientSecret = redact(app.SecondaryClientSecret)
+		copied.TikTok.Apps[i] = app
+	}
+	copied.OIDC.Clients = make([]oidc.Client, len(c.OIDC.Clients))
+	for i, client := range c.OIDC.Clients {
+		client.Secret = redact(client.Secret)
+		copied.OIDC.Clients[i] = client
+	}
+	return &copied
+}
+
+// redact masks a secret, keeping only whether it is set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// redactKeyring masks the key material but keeps the key IDs
+func redactKeyring(spec string) string {
+	var entries []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, _, _ := strings.Cut(entry, ":")
+		entries = append(entries, id+":[REDACTED]")
+	}
+	return strings.Join(entries, ",")
+}
+
+// envReader applies environment overrides and collects parse errors
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) string(key string, target *string) {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		*target = value
+	}
+}
+
+func (e *envReader) bool(key string, target *bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: invalid boolean %q", key, value))
+		return
+	}
+	*target = parsed
+}
+
+func (e *envReader) int(key string, target *int) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: invalid integer %q", key, value))
+		return
+	}
+	*target = parsed
+}
+
+func (e *envReader) duration(key string, target *Duration) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	if err := target.UnmarshalText([]byte(value)); err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: invalid duration %q", key, value))
+	}
+}
+
+func (e *envReader) list(key string, target *[]string) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*target = items
+}
+
+// jsonFile decodes a JSON value from an env var, or a YAML/JSON file named by fileKey
+func (e *envReader) jsonFile(key, fileKey string, target interface{}) {
+	if path, ok := os.LookupEnv(fileKey); ok && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %w", fileKey, err))
+			return
+		}
+		if err := yaml.Unmarshal(data, target); err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %w", fileKey, err))
+		}
+		return
+	}
+
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		if err := json.Unmarshal([]byte(value), target); err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: invalid JSON: %w", key, err))
+		}
+	}
+}
+
+// scopeProfiles merges "name=scope,scope;name=..." into the profile map
+func (e *envReader) scopeProfiles(key string, target *map[string][]string) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	if *target == nil {
+		*target = map[string][]string{}
+	}
+	profiles := *target
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, scopes, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			e.errs = append(e.errs, fmt.Errorf("%s: invalid entry %q", key, entry))
+			continue
+		}
+		profiles[name] = strings.FieldsFunc(scopes, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+}
+
+// getEnv returns an env var or the default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"tiktok-oauth2/oidc"
+)
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	c := validConfig()
+	c.Server.AdminAPIKey = "secret-admin-key"
+	c.Server.AdminAPIKeyFile = "/run/secrets/admin_api_key"
+	c.TikTok.ClientSecret = "secret-client"
+	c.TikTok.SecondaryClientSecret = "secret-client-secondary"
+	c.Tokens.EncryptionKeys = "k1:c2VjcmV0LWtleS1vbmU=, k2:c2VjcmV0LWtleS10d28="
+	c.Session.Secret = "secret-session-secret-of-32-bytes"
+	c.TikTok.Apps = []App{{ID: "other", ClientKey: "ck2", ClientSecret: "secret-app", SecondaryClientSecret: "secret-app-secondary"}}
+	c.OIDC.Clients = []oidc.Client{{ID: "rp", Secret: "secret-oidc-client"}}
+
+	redacted := c.Redacted()
+	yamlOut, err := yaml.Marshal(redacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonOut, err := json.Marshal(redacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := []string{
+		"secret-admin-key", "secret-client", "secret-session", "secret-app", "secret-oidc-client",
+		"c2VjcmV0LWtleS1vbmU=", "c2VjcmV0LWtleS10d28=",
+	}
+	for name, out := range map[string]string{"yaml": string(yamlOut), "json": string(jsonOut)} {
+		for _, secret := range secrets {
+			if strings.Contains(out, secret) {
+				t.Errorf("%s output contains %q:\n%s", name, secret, out)
+			}
+		}
+		// What is needed to check the configuration stays visible
+		for _, visible := range []string{"[REDACTED]", "k1:[REDACTED],k2:[REDACTED]", "/run/secrets/admin_api_key", "ck2"} {
+			if !strings.Contains(out, visible) {
+				t.Errorf("%s output lacks %q", name, visible)
+			}
+		}
+	}
+
+	// The original keeps its secrets
+	if c.TikTok.Apps[0].ClientSecret != "secret-app" || c.OIDC.Clients[0].Secret != "secret-oidc-client" || c.Session.Secret == "[REDACTED]" {
+		t.Error("Redacted modified the original configuration")
+	}
+}
+
+func TestRedactedKeepsUnsetSecretsEmpty(t *testing.T) {
+	c := validConfig()
+	c.TikTok.ClientSecret = ""
+	redacted := c.Redacted()
+	if redacted.TikTok.ClientSecret != "" || redacted.Server.AdminAPIKey != "" || redacted.Tokens.EncryptionKeys != "" {
+		t.Errorf("unset secrets shown as set: %+v", redacted)
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BasicScope is required for every login, it grants access to open_id
+const BasicScope = "user.info.basic"
+
+// KnownScopes is the allowlist of TikTok scopes that may be requested
+var KnownScopes = map[string]bool{
+	"user.info.basic":   true,
+	"user.info.profile": true,
+	"user.info.stats":   true,
+	"video.list":        true,
+	"video.upload":      true,
+	"video.publish":     true,
+}
+
+// defaultScopeProfiles returns the built-in scope profiles.
+// They can be extended or overridden with oauth.scope_profiles or TIKTOK_SCOPE_PROFILES.
+func defaultScopeProfiles() map[string][]string {
+	return map[string][]string{
+		"login":     {"user.info.basic"},
+		"creator":   {"user.info.basic", "user.info.profile", "user.info.stats", "video.list"},
+		"publisher": {"user.info.basic", "user.info.profile", "user.info.stats", "video.list", "video.upload", "video.publish"},
+	}
+}
+
+// ParseScopes parses a comma or space separated scope list and validates it
+// against KnownScopes. user.info.basic is always included.
+func ParseScopes(raw string) ([]string, error) {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	seen := map[string]bool{BasicScope: true}
+	scopes := []string{BasicScope}
+	var unknown []string
+	for _, scope := range fields {
+		if seen[scope] {
+			continue
+		}
+		if !KnownScopes[scope] {
+			unknown = append(unknown, scope)
+			continue
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown scopes: %s", strings.Join(unknown, ", "))
+	}
+	return scopes, nil
+}
+
+// ResolveScopes returns the scopes for an explicit scope list or a profile name.
+// When both are empty the default profile is used.
+func (c *Config) ResolveScopes(scopes, profile string) ([]string, error) {
+	if scopes != "" && profile != "" {
+		return nil, fmt.Errorf("use either scopes or profile, not both")
+	}
+	if scopes != "" {
+		return ParseScopes(scopes)
+	}
+
+	if profile == "" {
+		profile = c.OAuth.DefaultScopeProfile
+	}
+	profileScopes, ok := c.OAuth.ScopeProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown scope profile: %s (available: %s)", profile, strings.Join(c.ProfileNames(), ", "))
+	}
+	return ParseScopes(joinScopes(profileScopes))
+}
+
+// ProfileNames returns the configured scope profile names in sorted order
+func (c *Config) ProfileNames() []string {
+	return sortedKeys(c.OAuth.ScopeProfiles)
+}
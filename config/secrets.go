@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretFile caches a secret read from a file
+type secretFile struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+var (
+	secretFilesMu sync.Mutex
+	secretFiles   = map[string]*secretFile{}
+)
+
+// ReadSecretFile returns the trimmed content of a secret file (e.g. a Docker or Kubernetes secret).
+// The file is re-read when its modification time or size changes, so rotated secrets are
+// picked up without a restart. If the file becomes unreadable the last value is returned with the error.
+func ReadSecretFile(path string) (string, error) {
+	secretFilesMu.Lock()
+	defer secretFilesMu.Unlock()
+
+	cached := secretFiles[path]
+	info, err := os.Stat(path)
+	if err != nil {
+		if cached != nil {
+			return cached.value, err
+		}
+		return "", err
+	}
+	if cached != nil && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.value, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if cached != nil {
+			return cached.value, err
+		}
+		return "", err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+
+	if cached != nil && cached.value != value {
+		slog.Info("🔑 Secret file changed, using the new value", "path", path)
+	}
+	secretFiles[path] = &secretFile{modTime: info.ModTime(), size: info.Size(), value: value}
+	return value, nil
+}
+
+// resolveSecret returns the secret from file when a path is set, otherwise the inline value
+func resolveSecret(value, file string) string {
+	if file == "" {
+		return value
+	}
+	secret, err := ReadSecretFile(file)
+	if err != nil {
+		slog.Warn("⚠️ Failed to read secret file", "path", file, "error", err)
+	}
+	return secret
+}
+
+// ClientSecrets returns the app's client secrets, primary first, followed by the
+// secondary secret used during a rotation window
+func (a *App) ClientSecrets() []string {
+	var secrets []string
+	if primary := resolveSecret(a.ClientSecret, a.ClientSecretFile); primary != "" {
+		secrets = append(secrets, primary)
+	}
+	if secondary := resolveSecret(a.SecondaryClientSecret, a.SecondaryClientSecretFile); secondary != "" {
+		secrets = append(secrets, secondary)
+	}
+	return secrets
+}
+
+// CurrentAdminAPIKey returns the admin API key, re-reading admin_api_key_file when it changes
+func (c *Config) CurrentAdminAPIKey() string {
+	return resolveSecret(c.Server.AdminAPIKey, c.Server.AdminAPIKeyFile)
+}
+
+// CurrentSessionSecret returns the session secret, re-reading session.secret_file when it changes
+func (c *Config) CurrentSessionSecret() string {
+	return resolveSecret(c.Session.Secret, c.Session.SecretFile)
+}
+
+// CurrentEncryptionKeys returns the token encryption keys, re-reading tokens.encryption_keys_file when it changes
+func (c *Config) CurrentEncryptionKeys() string {
+	return resolveSecret(c.Tokens.EncryptionKeys, c.Tokens.EncryptionKeysFile)
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tiktok-oauth2/keyring"
+	"tiktok-oauth2/logging"
+	"tiktok-oauth2/oidc"
+	"tiktok-oauth2/tiktok"
+)
+
+// Validate checks the configuration and returns every problem found, joined into one error
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Server
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		add("server.port: %q is not a valid port", c.Server.Port)
+	}
+	if c.Server.AdminAPIKeyFile != "" {
+		if _, err := ReadSecretFile(c.Server.AdminAPIKeyFile); err != nil {
+			add("server.admin_api_key_file: %v", err)
+		}
+	}
+	if c.Server.PublicURL != "" && !absoluteURL(c.Server.PublicURL) {
+		add("server.public_url: %q is not an absolute URL", c.Server.PublicURL)
+	}
+	if _, err := logging.ParseLevel(c.Server.LogLevel); err != nil {
+		add("server.log_level: %v (use debug, info, warn or error)", err)
+	}
+	switch c.Server.LogFormat {
+	case logging.FormatText, logging.FormatJSON:
+	default:
+		add("server.log_format: unknown format %q (use text or json)", c.Server.LogFormat)
+	}
+
+	// TikTok endpoints and apps
+	for _, endpoint := range []struct{ name, value string }{
+		{"tiktok.auth_url", c.TikTok.AuthURL},
+		{"tiktok.token_url", c.TikTok.TokenURL},
+		{"tiktok.revoke_url", c.TikTok.RevokeURL},
+		{"tiktok.user_info_url", c.TikTok.UserInfoURL},
+	} {
+		if !absoluteURL(endpoint.value) {
+			add("%s: %q is not an absolute URL", endpoint.name, endpoint.value)
+		}
+	}
+	apps, _, err := c.Apps()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, id := range sortedKeys(apps) {
+		app := apps[id]
+		if uri := app.RedirectURI; uri != "" && !absoluteURL(uri) {
+			add("app %q: redirect_uri %q is not an absolute URL", id, uri)
+		}
+		for _, file := range []string{app.ClientSecretFile, app.SecondaryClientSecretFile} {
+			if file == "" {
+				continue
+			}
+			if _, err := ReadSecretFile(file); err != nil {
+				add("app %q: %v", id, err)
+			}
+		}
+	}
+
+	// Scopes
+	for _, name := range sortedKeys(c.OAuth.ScopeProfiles) {
+		if _, err := ParseScopes(joinScopes(c.OAuth.ScopeProfiles[name])); err != nil {
+			add("oauth.scope_profiles.%s: %v", name, err)
+		}
+	}
+	if _, ok := c.OAuth.ScopeProfiles[c.OAuth.DefaultScopeProfile]; !ok {
+		add("oauth.default_scope_profile: unknown profile %q", c.OAuth.DefaultScopeProfile)
+	}
+	for _, origin := range c.OAuth.ReturnToAllowlist {
+		if Origin(strings.TrimSpace(origin)) == "" {
+			add("oauth.return_to_allowlist: %q is not a valid http(s) origin", origin)
+		}
+	}
+
+	// Token storage
+	switch c.Tokens.Store {
+	case "memory":
+	case "file":
+		if c.Tokens.Path == "" {
+			add("tokens.path: required for the file store")
+		}
+	default:
+		add("tokens.store: unknown store %q (use memory or file)", c.Tokens.Store)
+	}
+	keys := c.Tokens.EncryptionKeys
+	if c.Tokens.EncryptionKeysFile != "" {
+		var err error
+		if keys, err = ReadSecretFile(c.Tokens.EncryptionKeysFile); err != nil {
+			add("tokens.encryption_keys_file: %v", err)
+		}
+	}
+	if keys != "" {
+		if _, err := keyring.ParseKeys(keys, c.Tokens.EncryptionPrimary); err != nil {
+			add("tokens.encryption_keys: %v", err)
+		}
+	}
+	if c.Tokens.AutoRefresh.Enabled {
+		if c.Tokens.AutoRefresh.Concurrency < 1 {
+			add("tokens.auto_refresh.concurrency: must be at least 1")
+		}
+		if c.Tokens.AutoRefresh.MaxAttempts < 1 {
+			add("tokens.auto_refresh.max_attempts: must be at least 1")
+		}
+	}
+
+	// Sessions
+	if c.Session.Enabled {
+		secret := c.Session.Secret
+		if c.Session.SecretFile != "" {
+			var err error
+			if secret, err = ReadSecretFile(c.Session.SecretFile); err != nil {
+				add("session.secret_file: %v", err)
+			}
+		}
+		if len(secret) < 32 {
+			add("session.secret: must be at least 32 bytes when sessions are enabled")
+		}
+		if c.Session.CookieName == "" {
+			add("session.cookie_name: required when sessions are enabled")
+		}
+	}
+
+	// JWT issuing; a generated key would change on every restart and differ between replicas
+	if c.JWT.Enabled {
+		if c.JWT.PrivateKeyFile == "" {
+			add("jwt.private_key_file: required when jwt.enabled is set")
+		}
+		if c.JWT.Audience == "" {
+			add("jwt.audience: required when jwt.enabled is set")
+		}
+	}
+
+	// OpenID Connect
+	if len(c.OIDC.Clients) > 0 {
+		if _, err := oidc.ClientMap(c.OIDC.Clients); err != nil {
+			add("oidc.clients: %v", err)
+		}
+		if !c.JWT.Enabled {
+			add("oidc.clients: OpenID Connect requires jwt.enabled")
+		}
+		for _, client := range c.OIDC.Clients {
+			if client.ID == c.JWT.Audience {
+				add("oidc.clients: client id %s must differ from jwt.audience", client.ID)
+			}
+			if client.App != "" && apps[client.App] == nil {
+				add("oidc.clients: client %s uses unknown app %q", client.ID, client.App)
+			}
+			for _, uri := range client.RedirectURIs {
+				if !absoluteURL(uri) {
+					add("oidc.clients: client %s redirect_uri %q is not an absolute URL", client.ID, uri)
+				}
+			}
+		}
+	}
+
+	// Upstream retries
+	if c.Upstream.Retry.MaxAttempts < 1 {
+		add("upstream.retry.max_attempts: must be at least 1")
+	}
+	if c.Upstream.Retry.MaxDelay < c.Upstream.Retry.BaseDelay {
+		add("upstream.retry.max_delay: must not be shorter than base_delay")
+	}
+
+	// Upstream circuit breaker
+	if c.Upstream.Breaker.FailureThreshold < 1 {
+		add("upstream.breaker.failure_threshold: must be at least 1")
+	}
+	if c.Upstream.Breaker.HalfOpenRequests < 1 {
+		add("upstream.breaker.half_open_requests: must be at least 1")
+	}
+
+	// Upstream quotas
+	quotaEndpoints := []string{tiktok.EndpointToken, tiktok.EndpointRevoke, tiktok.EndpointUserInfo}
+	for _, endpoint := range sortedKeys(c.Upstream.Quota.Endpoints) {
+		limit := c.Upstream.Quota.Endpoints[endpoint]
+		if !slices.Contains(quotaEndpoints, endpoint) {
+			add("upstream.quota.endpoints: unknown endpoint %q (use %s)", endpoint, strings.Join(quotaEndpoints, ", "))
+		}
+		if limit.Requests < 1 {
+			add("upstream.quota.endpoints.%s.requests: must be at least 1", endpoint)
+		}
+		if limit.Window <= 0 {
+			add("upstream.quota.endpoints.%s.window: must be positive", endpoint)
+		}
+	}
+	if c.Upstream.Quota.MaxWait < 0 {
+		add("upstream.quota.max_wait: must not be negative")
+	}
+
+	// Rate limits
+	if _, err := c.RateLimit.TrustedProxyPrefixes(); err != nil {
+		add("rate_limit.trusted_proxies: %v", err)
+	}
+	for _, route := range sortedKeys(c.RateLimit.Routes) {
+		limit := c.RateLimit.Routes[route]
+		if !slices.Contains(RateLimitRoutes, route) {
+			add("rate_limit.routes: unknown route %q (use %s)", route, strings.Join(RateLimitRoutes, ", "))
+		}
+		if limit.Requests < 1 {
+			add("rate_limit.routes.%s.requests: must be at least 1", route)
+		}
+		if limit.Per <= 0 {
+			add("rate_limit.routes.%s.per: must be positive", route)
+		}
+		if limit.Burst < 0 {
+			add("rate_limit.routes.%s.burst: must not be negative", route)
+		}
+		switch limit.Key {
+		case "", RateLimitKeyIP, RateLimitKeyAPIKey, RateLimitKeyOpenID:
+		default:
+			add("rate_limit.routes.%s.key: unknown key %q (use ip, api_key or open_id)", route, limit.Key)
+		}
+	}
+
+	// Durations
+	for _, duration := range []struct {
+		name  string
+		value Duration
+	}{
+		{"oauth.state_ttl", c.OAuth.StateTTL},
+		{"oauth.ticket_ttl", c.OAuth.TicketTTL},
+		{"tokens.auto_refresh.interval", c.Tokens.AutoRefresh.Interval},
+		{"tokens.auto_refresh.window", c.Tokens.AutoRefresh.Window},
+		{"client_token.renew_before", c.ClientToken.RenewBefore},
+		{"session.ttl", c.Session.TTL},
+		{"jwt.ttl", c.JWT.TTL},
+		{"oidc.code_ttl", c.OIDC.CodeTTL},
+		{"upstream.retry.base_delay", c.Upstream.Retry.BaseDelay},
+		{"upstream.retry.max_delay", c.Upstream.Retry.MaxDelay},
+		{"upstream.retry.deadline", c.Upstream.Retry.Deadline},
+		{"upstream.breaker.open_timeout", c.Upstream.Breaker.OpenTimeout},
+		{"upstream.timeouts.exchange_code", c.Upstream.Timeouts.ExchangeCode},
+		{"upstream.timeouts.refresh", c.Upstream.Timeouts.Refresh},
+		{"upstream.timeouts.revoke", c.Upstream.Timeouts.Revoke},
+		{"upstream.timeouts.user_info", c.Upstream.Timeouts.UserInfo},
+		{"upstream.timeouts.client_token", c.Upstream.Timeouts.ClientToken},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+	} {
+		if duration.value <= 0 {
+			add("%s: must be positive", duration.name)
+		}
+	}
+	if c.Tokens.AutoRefresh.Jitter < 0 {
+		add("tokens.auto_refresh.jitter: must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// absoluteURL reports whether raw is an absolute http(s) URL
+func absoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// normalizeOrigins reduces URLs to their normalized origins, dropping invalid entries
+func normalizeOrigins(values []string) []string {
+	var origins []string
+	for _, value := range values {
+		if origin := Origin(strings.TrimSpace(value)); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// joinScopes joins a scope list for ParseScopes
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tiktok-oauth2/oidc"
+)
+
+// validConfig returns a minimal valid configuration
+func validConfig() *Config {
+	c := Defaults()
+	c.TikTok.ClientKey = "ck"
+	c.TikTok.ClientSecret = "secret"
+	c.TikTok.RedirectURI = "https://example.com/callback"
+	return c
+}
+
+// invalidConfigs break one setting each and name the message they must produce
+var invalidConfigs = []struct {
+	name   string
+	modify func(c *Config)
+	want   string
+}{
+	{"port", func(c *Config) { c.Server.Port = "http" }, `server.port: "http" is not a valid port`},
+	{"public url", func(c *Config) { c.Server.PublicURL = "example.com" }, "server.public_url"},
+	{"log level", func(c *Config) { c.Server.LogLevel = "loud" }, "server.log_level"},
+	{"log format", func(c *Config) { c.Server.LogFormat = "xml" }, "server.log_format"},
+	{"token url", func(c *Config) { c.TikTok.TokenURL = "/oauth/token" }, "tiktok.token_url"},
+	{"default scope profile", func(c *Config) { c.OAuth.DefaultScopeProfile = "missing" }, "oauth.default_scope_profile"},
+	{"return_to origin", func(c *Config) { c.OAuth.ReturnToAllowlist = []string{"ftp://example.com"} }, "oauth.return_to_allowlist"},
+	{"token store", func(c *Config) { c.Tokens.Store = "redis" }, "tokens.store"},
+	{"encryption keys", func(c *Config) { c.Tokens.EncryptionKeys = "k1:not-base64!" }, "tokens.encryption_keys"},
+	{"session secret", func(c *Config) { c.Session.Enabled = true; c.Session.Secret = "short" }, "session.secret: must be at least 32 bytes"},
+	{"session secret file", func(c *Config) { c.Session.Enabled = true; c.Session.SecretFile = filepath.Join("missing", "secret") }, "session.secret_file"},
+	{"jwt key", func(c *Config) { c.JWT.Enabled = true; c.JWT.PrivateKeyFile = "" }, "jwt.private_key_file"},
+	{"oidc redirect uri", func(c *Config) {
+		c.OIDC.Clients = []oidc.Client{{ID: "rp", RedirectURIs: []string{"/cb"}}}
+	}, `oidc.clients: client rp redirect_uri "/cb" is not an absolute URL`},
+	{"retry attempts", func(c *Config) { c.Upstream.Retry.MaxAttempts = 0 }, "upstream.retry.max_attempts"},
+	{"breaker threshold", func(c *Config) { c.Upstream.Breaker.FailureThreshold = 0 }, "upstream.breaker.failure_threshold"},
+	{"quota endpoint", func(c *Config) {
+		c.Upstream.Quota.Endpoints = map[string]QuotaLimit{"videos": {Requests: 1, Window: Duration(time.Minute)}}
+	}, `upstream.quota.endpoints: unknown endpoint "videos"`},
+	{"rate limit route", func(c *Config) {
+		c.RateLimit.Routes = map[string]RouteLimit{"auth": {Requests: 0, Per: Duration(time.Minute)}}
+	}, "rate_limit.routes.auth.requests"},
+	{"duration", func(c *Config) { c.OAuth.StateTTL = 0 }, "oauth.state_ttl: must be positive"},
+	{"jitter", func(c *Config) { c.Tokens.AutoRefresh.Jitter = Duration(-time.Second) }, "tokens.auto_refresh.jitter"},
+}
+
+func TestValidateAcceptsValidConfig(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidateReportsEachError(t *testing.T) {
+	for _, tt := range invalidConfigs {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+			err := c.Validate()
+			if err == nil {
+				t.Fatal("Validate accepted the configuration")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCollectsAllErrors(t *testing.T) {
+	c := validConfig()
+	for _, tt := range invalidConfigs {
+		tt.modify(c)
+	}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted the configuration")
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("error %T does not join the problems", err)
+	}
+	if got := len(joined.Unwrap()); got < len(invalidConfigs) {
+		t.Errorf("%d errors reported, want at least %d", got, len(invalidConfigs))
+	}
+	for _, tt := range invalidConfigs {
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("report does not mention %q (%s)", tt.want, tt.name)
+		}
+	}
+}
+
+func TestValidateChecksSecretFileContents(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, value string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	c := validConfig()
+	c.Session.Enabled = true
+	c.Session.SecretFile = write("short_secret", "short")
+	c.Tokens.EncryptionKeysFile = write("bad_keys", "k1:not-base64!")
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted invalid secret files")
+	}
+	for _, want := range []string{"session.secret: must be at least 32 bytes", "tokens.encryption_keys: "} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	c.Session.SecretFile = write("secret", strings.Repeat("s", 32))
+	c.Tokens.EncryptionKeysFile = write("keys", "k1:"+base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate with valid secret files: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/utils"
+)
+
+// RequireAPIKey protects internal endpoints with the X-API-Key header.
+// When neither ADMIN_API_KEY nor ADMIN_API_KEY_FILE is set the endpoints are disabled.
+func (s *Server) RequireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminAPIKey() == "" {
+			utils.WriteJSONResponse(w, http.StatusForbidden, models.APIResponse{
+				Success: false,
+				Error:   "Internal endpoints are disabled, set ADMIN_API_KEY to enable them",
+			})
+			return
+		}
+
+		if !s.validAPIKey(r) {
+			utils.WriteJSONResponse(w, http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Error:   "Invalid or missing API key",
+			})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// validAPIKey reports whether the request carries the configured X-API-Key
+func (s *Server) validAPIKey(r *http.Request) bool {
+	key := r.Header.Get("X-API-Key")
+	adminKey := s.adminAPIKey()
+	return adminKey != "" && key != "" &&
+		subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1
+}
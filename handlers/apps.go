@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// appContextKey is the request context key for the app selected by the route
+type appContextKey struct{}
+
+// WithApp serves next for the given app ID, for routers that have no {app} path variable.
+// An empty ID selects the default app.
+func WithApp(appID string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), appContextKey{}, appID)))
+	})
+}
+
+// routeApp returns the app ID selected by the route, "" for unprefixed routes
+func routeApp(r *http.Request) string {
+	id, _ := r.Context().Value(appContextKey{}).(string)
+	return id
+}
+
+// appRoute passes the {app} path variable of the gorilla/mux route on to the handler
+func appRoute(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WithApp(mux.Vars(r)["app"], next).ServeHTTP(w, r)
+	}
+}
+
+// requestApp returns the app selected by the route (e.g. /apps/{app}/...) or the ?app= parameter,
+// and the default app otherwise. It writes a 404 and returns false for unknown apps.
+func (s *Server) requestApp(w http.ResponseWriter, r *http.Request) (*config.App, bool) {
+	id := routeApp(r)
+	if id == "" {
+		id = r.URL.Query().Get("app")
+	}
+
+	app, ok := s.app(id)
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Error:   "Unknown app: " + id,
+		})
+		return nil, false
+	}
+	return app, true
+}
+
+// storedTokenApp returns the app a stored token belongs to, tokens without app ID use the default app
+func (s *Server) storedTokenApp(token *models.StoredToken) (*config.App, error) {
+	app, ok := s.app(token.AppID)
+	if !ok {
+		return nil, fmt.Errorf("unknown app %q for %s", token.AppID, token.OpenID)
+	}
+	return app, nil
+}
+
+// accessTokenApp returns the app a stored access token belongs to, or fallback for
+// tokens that are not stored (e.g. bearer tokens of clients keeping their own tokens)
+func (s *Server) accessTokenApp(accessToken string, fallback *config.App) *config.App {
+	if stored := s.findStoredToken(accessToken); stored != nil {
+		if app, err := s.storedTokenApp(stored); err == nil {
+			return app
+		}
+	}
+	return fallback
+}
@@ -1,22 +1,56 @@
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"net/http"
-	"net/url"
+	"strings"
 	"tiktok-oauth2/config"
 	"tiktok-oauth2/models"
+	"tiktok-oauth2/tiktok"
 	"tiktok-oauth2/utils"
 )
 
 // AuthHandler handles the initial OAuth authorization request
-func AuthHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AuthHandler(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.requestApp(w, r)
+	if !ok {
+		return
+	}
+
+	// Resolve requested scopes from ?scopes= or ?profile=
+	query := r.URL.Query()
+	scopes, err := s.cfg.ResolveScopes(query.Get("scopes"), query.Get("profile"))
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid scope selection: " + err.Error(),
+		})
+		return
+	}
+
+	// Validate optional return_to against the allowlist
+	returnTo := query.Get("return_to")
+	if returnTo != "" && !s.validReturnTo(returnTo) {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "return_to is not an allowed URL",
+		})
+		return
+	}
+
+	s.startAuthFlow(w, r, app, models.AuthState{ReturnTo: returnTo}, scopes, s.usePKCE(r))
+}
+
+// startAuthFlow stores a new state for the flow and redirects to the app's TikTok authorization page.
+// authState carries flow data for the callback; app, state, timestamps and PKCE verifier are filled in.
+func (s *Server) startAuthFlow(w http.ResponseWriter, r *http.Request, app *config.App, authState models.AuthState, scopes []string, pkce bool) {
 	// Generate random state for CSRF protection
 	state, err := generateRandomState()
 	if err != nil {
-		config.DebugLog("❌ Failed to generate state parameter: %v", err)
+		s.log(r.Context()).Error("❌ Failed to generate state parameter", "error", err)
 		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Error:   "Failed to generate state parameter",
@@ -24,22 +58,53 @@ func AuthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store state (in production, use Redis or database)
-	// For now, we'll just validate it in callback
-	_ = state
+	// Generate PKCE verifier if enabled for this flow
+	var codeVerifier, codeChallenge string
+	if pkce {
+		codeVerifier, err = utils.GenerateCodeVerifier()
+		if err != nil {
+			s.log(r.Context()).Error("❌ Failed to generate PKCE verifier", "error", err)
+			utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error:   "Failed to generate PKCE verifier",
+			})
+			return
+		}
+		codeChallenge = utils.CodeChallengeS256(codeVerifier)
+	}
+
+	// Store state so the callback can verify it exactly once
+	now := s.now()
+	authState.App = app.ID
+	authState.State = state
+	authState.Created = now.Unix()
+	authState.Expires = now.Add(s.cfg.OAuth.StateTTL.Duration()).Unix()
+	authState.CodeVerifier = codeVerifier
+	if err := s.states.Save(authState); err != nil {
+		s.log(r.Context()).Error("❌ Failed to store state parameter", "error", err)
+		s.onError(r, fmt.Errorf("failed to store state parameter: %w", err))
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error:   "Failed to store state parameter",
+		})
+		return
+	}
 
 	// Build authorization URL
-	authURL := buildAuthURL(state)
-	config.DebugLog("🔗 Generated auth URL: %s", authURL)
-	config.DebugLog("🛡️ Generated state: %s", state)
+	authURL := s.buildAuthURL(r.Context(), app, state, codeChallenge, scopes)
 
 	// Redirect to TikTok OAuth page
-	config.DebugLog("↗️ Redirecting to TikTok OAuth page")
+	s.log(r.Context()).Debug("↗️ Redirecting to TikTok OAuth page")
 	http.Redirect(w, r, authURL, http.StatusFound)
 }
 
 // RefreshTokenHandler handles token refresh requests
-func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.requestApp(w, r)
+	if !ok {
+		return
+	}
+
 	// Get refresh token from request body
 	var req struct {
 		RefreshToken string `json:"refresh_token"`
@@ -61,53 +126,16 @@ func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create HTTP client
-	client := utils.NewHTTPClient("")
-
-	// Prepare form data for token refresh
-	formData := url.Values{}
-	formData.Add("client_key", config.ClientKey)
-	formData.Add("client_secret", config.ClientSecret)
-	formData.Add("grant_type", "refresh_token")
-	formData.Add("refresh_token", req.RefreshToken)
-
-	// Make request to TikTok token endpoint
-	resp, err := client.PostForm(config.TokenURL, formData)
+	// Refresh the access token at TikTok
+	tokenData, err := s.RefreshAccessToken(r.Context(), app, req.RefreshToken)
 	if err != nil {
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to refresh token: " + err.Error(),
-		})
-		return
-	}
-
-	// Parse response
-	var tokenResp models.TokenResponse
-	if err := utils.ReadJSONResponse(resp, &tokenResp); err != nil {
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to parse token response: " + err.Error(),
-		})
-		return
-	}
-
-	// Check if we got a valid access token
-	if tokenResp.AccessToken == "" {
-		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
-			Success: false,
-			Error:   "No access token received",
-		})
+		s.onError(r, fmt.Errorf("failed to refresh token: %w", err))
+		writeUpstreamError(w, "Failed to refresh token", err)
 		return
 	}
 
-	// Convert to TokenResponseData format
-	tokenData := models.TokenResponseData{
-		AccessToken:      tokenResp.AccessToken,
-		ExpiresIn:        tokenResp.ExpiresIn,
-		OpenID:           tokenResp.OpenID,
-		RefreshToken:     tokenResp.RefreshToken,
-		RefreshExpiresIn: tokenResp.RefreshExpiresIn,
-	}
+	// Keep the stored token in sync
+	s.saveToken(r.Context(), app, tokenData)
 
 	// Return success response
 	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
@@ -117,6 +145,17 @@ func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// RefreshAccessToken exchanges a refresh token of an app for a new access token
+func (s *Server) RefreshAccessToken(ctx context.Context, app *config.App, refreshToken string) (*models.TokenResponseData, error) {
+	tokenData, err := s.tiktok(app).Refresh(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.onRefresh(RefreshEvent{AppID: app.ID, Token: *tokenData})
+	return tokenData, nil
+}
+
 // generateRandomState generates a random state string for CSRF protection
 func generateRandomState() (string, error) {
 	bytes := make([]byte, 16)
@@ -126,24 +165,36 @@ func generateRandomState() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// buildAuthURL constructs the TikTok OAuth authorization URL
-func buildAuthURL(state string) string {
-	params := url.Values{}
-	params.Add("client_key", config.ClientKey)
-	params.Add("redirect_uri", config.RedirectURI)
-	params.Add("response_type", "code")
-	params.Add("scope", "user.info.basic,user.info.profile,user.info.stats,video.list,video.upload,video.publish")
-	params.Add("state", state)
-
-	authURL := fmt.Sprintf("%s?%s", config.AuthURL, params.Encode())
-
-	config.DebugLog("🔧 Building auth URL with params:")
-	config.DebugLog("  - client_key: %s", config.ClientKey)
-	config.DebugLog("  - redirect_uri: %s", config.RedirectURI)
-	config.DebugLog("  - response_type: code")
-	config.DebugLog("  - scope: user.info.basic,user.info.profile,user.info.stats,video.list,video.upload,video.publish")
-	config.DebugLog("  - state: %s", state)
-	config.DebugLog("  - Final URL: %s", authURL)
+// usePKCE reports whether the flow should use PKCE.
+// The "pkce" query parameter overrides the PKCE_ENABLED default.
+func (s *Server) usePKCE(r *http.Request) bool {
+	switch r.URL.Query().Get("pkce") {
+	case "true", "1":
+		return true
+	case "false", "0":
+		return false
+	default:
+		return s.cfg.OAuth.PKCEEnabled
+	}
+}
+
+// buildAuthURL constructs the TikTok OAuth authorization URL for an app.
+// codeChallenge is added together with its method when non-empty.
+func (s *Server) buildAuthURL(ctx context.Context, app *config.App, state, codeChallenge string, scopes []string) string {
+	authURL := s.tiktok(app).AuthorizeURL(tiktok.AuthorizeParams{
+		RedirectURI:   app.RedirectURI,
+		State:         state,
+		Scopes:        scopes,
+		CodeChallenge: codeChallenge,
+	})
+
+	s.log(ctx).Debug("🔗 Built auth URL",
+		"app", app.ID,
+		"client_key", app.ClientKey,
+		"redirect_uri", app.RedirectURI,
+		"scope", strings.Join(scopes, ","),
+		"pkce", codeChallenge != "",
+	)
 
 	return authURL
 }
@@ -1,18 +1,17 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
+	"strings"
 	"tiktok-oauth2/config"
 	"tiktok-oauth2/models"
 	"tiktok-oauth2/utils"
 )
 
 // CallbackHandler handles the OAuth callback from TikTok
-func CallbackHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	// Get query parameters
 	query := r.URL.Query()
 	code := query.Get("code")
@@ -20,16 +19,24 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	errorParam := query.Get("error")
 	errorDescription := query.Get("error_description")
 
-	// Debug: Log all query parameters
-	config.DebugLog("🔍 Callback received - Full URL: %s", r.URL.String())
-	config.DebugLog("📝 Query parameters: %+v", query)
-	config.DebugLog("🔑 Code: %s", code)
-	config.DebugLog("🛡️ State: %s", state)
-	config.DebugLog("❌ Error: %s", errorParam)
-	config.DebugLog("📄 Error Description: %s", errorDescription)
+	// Code and state are secrets, only their presence is logged
+	s.log(r.Context()).Debug("🔍 Callback received",
+		"has_code", code != "",
+		"has_state", state != "",
+		"error", errorParam,
+		"error_description", errorDescription,
+	)
 
 	// Check for OAuth errors
 	if errorParam != "" {
+		// Relying parties get the error on their redirect URI
+		if state != "" {
+			if authState, err := s.states.Consume(state); err == nil && authState.OIDC != nil {
+				redirectOIDCError(w, r, authState.OIDC, "access_denied", errorDescription)
+				return
+			}
+		}
+		s.onError(r, fmt.Errorf("OAuth error: %s - %s", errorParam, errorDescription))
 		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
 			Success: false,
 			Error:   fmt.Sprintf("OAuth error: %s - %s", errorParam, errorDescription),
@@ -46,8 +53,6 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// In production, validate state parameter against stored value
-	// For now, we'll just check if it exists
 	if state == "" {
 		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
 			Success: false,
@@ -56,37 +61,89 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Exchange authorization code for access token
-	config.DebugLog("🔄 Starting token exchange process...")
-	tokenData, err := exchangeCodeForToken(code)
+	// Validate state against the stored value (one-time use)
+	authState, err := s.states.Consume(state)
 	if err != nil {
-		config.DebugLog("❌ Token exchange error: %v", err)
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+		s.log(r.Context()).Debug("❌ State validation failed", "error", err)
+		s.onError(r, fmt.Errorf("invalid state parameter: %w", err))
+		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid state parameter: " + err.Error(),
+		})
+		return
+	}
+
+	// The flow must finish on the callback of the app it was started for
+	app, ok := s.app(authState.App)
+	if routeApp := routeApp(r); !ok || (routeApp != "" && routeApp != app.ID) {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Error:   "Failed to exchange code for token: " + err.Error(),
+			Error:   "State was issued for a different app",
 		})
 		return
 	}
 
-	// Debug: Log token data
-	config.DebugLog("✅ Token data received: %+v", tokenData)
+	// Exchange authorization code for access token
+	tokenData, err := s.exchangeCodeForToken(r.Context(), app, code, authState.CodeVerifier)
+	if err != nil {
+		s.log(r.Context()).Warn("❌ Token exchange failed", "app", app.ID, "error", err)
+		s.onError(r, fmt.Errorf("failed to exchange code for token: %w", err))
+		if authState.OIDC != nil {
+			redirectOIDCError(w, r, authState.OIDC, "server_error", "Failed to exchange code for token")
+			return
+		}
+		writeUpstreamError(w, "Failed to exchange code for token", err)
+		return
+	}
+
+	// Persist token so it can be retrieved by open_id later
+	s.saveToken(r.Context(), app, tokenData)
 
 	// Fetch user info using the access token
-	config.DebugLog("👤 Fetching user info with access token: %s", tokenData.AccessToken)
-	userInfo, err := FetchUserInfo(tokenData.AccessToken)
+	userInfo, err := s.FetchUserInfo(r.Context(), app, tokenData.AccessToken, UserInfoFieldsForScope(tokenData.Scope))
 	if err != nil {
 		// Log error but don't fail the entire request
 		// User can still get token and fetch user info separately
-		config.DebugLog("⚠️ Warning: Failed to fetch user info: %v", err)
+		s.log(r.Context()).Warn("⚠️ Failed to fetch user info", "open_id", tokenData.OpenID, "error", err)
 		userInfo = &models.UserInfo{} // Empty user info
-	} else {
-		config.DebugLog("✅ User info received: %+v", userInfo)
+	}
+
+	s.onLogin(r, LoginEvent{AppID: app.ID, Token: *tokenData, UserInfo: *userInfo})
+
+	// Flows started by a relying party continue with an authorization code
+	if authState.OIDC != nil {
+		s.completeOIDCAuthorization(w, r, authState.OIDC, tokenData, userInfo)
+		return
+	}
+
+	// In session mode tokens stay server-side and only a session cookie is returned
+	if s.sessions != nil {
+		s.writeSessionResponse(w, r, app, tokenData, userInfo, authState.ReturnTo)
+		return
 	}
 
 	// Create combined response
 	authResponse := models.AuthResponse{
 		Token:    *tokenData,
 		UserInfo: *userInfo,
+		JWT:      s.issueJWT(r.Context(), tokenData, userInfo),
+	}
+
+	// Redirect back to the frontend with a ticket the backend can redeem
+	if authState.ReturnTo != "" {
+		ticket, err := s.tickets.Create(authResponse)
+		if err != nil {
+			s.log(r.Context()).Error("❌ Failed to create ticket", "error", err)
+			s.onError(r, fmt.Errorf("failed to create ticket: %w", err))
+			utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error:   "Failed to create ticket",
+			})
+			return
+		}
+		s.log(r.Context()).Debug("↗️ Redirecting to return_to", "return_to", authState.ReturnTo)
+		redirectWithParam(w, r, authState.ReturnTo, "ticket", ticket)
+		return
 	}
 
 	// Return success response with token and user data
@@ -97,119 +154,57 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// exchangeCodeForToken exchanges authorization code for access token
-func exchangeCodeForToken(code string) (*models.TokenResponseData, error) {
-	// Create HTTP client
-	client := utils.NewHTTPClient("")
-
-	// Prepare form data
-	formData := url.Values{}
-	formData.Add("client_key", config.ClientKey)
-	formData.Add("client_secret", config.ClientSecret)
-	formData.Add("grant_type", "authorization_code")
-	formData.Add("code", code)
-	formData.Add("redirect_uri", config.RedirectURI)
-
-	// Make request to TikTok token endpoint
-	config.DebugLog("🔄 Making token request to: %s", config.TokenURL)
-	config.DebugLog("📝 Form data: %+v", formData)
-	config.DebugLog("🔑 Client Key: %s", config.ClientKey)
-	config.DebugLog("🔐 Client Secret: %s", config.ClientSecret)
-	config.DebugLog("🌐 Redirect URI: %s", config.RedirectURI)
-
-	resp, err := client.PostForm(config.TokenURL, formData)
-	if err != nil {
-		config.DebugLog("❌ Token request failed: %v", err)
-		return nil, fmt.Errorf("token request failed: %w", err)
-	}
-
-	// Debug: Log response status and body
-	config.DebugLog("📊 Response status: %d", resp.StatusCode)
-	config.DebugLog("📋 Response headers: %+v", resp.Header)
+// exchangeCodeForToken exchanges an app's authorization code for access token.
+// codeVerifier is sent when the flow was started with PKCE.
+func (s *Server) exchangeCodeForToken(ctx context.Context, app *config.App, code, codeVerifier string) (*models.TokenResponseData, error) {
+	s.log(ctx).Debug("🔄 Exchanging code", "app", app.ID, "client_key", app.ClientKey, "redirect_uri", app.RedirectURI, "pkce", codeVerifier != "")
 
-	// Read raw response body for debugging
-	bodyBytes, err := io.ReadAll(resp.Body)
+	tokenData, err := s.tiktok(app).ExchangeCode(ctx, code, app.RedirectURI, codeVerifier)
 	if err != nil {
-		config.DebugLog("❌ Failed to read response body: %v", err)
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	// Log raw response
-	config.DebugLog("📄 Raw response body: %s", string(bodyBytes))
-
-	// Parse response
-	var tokenResp models.TokenResponse
-	if err := json.Unmarshal(bodyBytes, &tokenResp); err != nil {
-		config.DebugLog("❌ Failed to parse token response: %v", err)
-		return nil, fmt.Errorf("failed to parse token response: %w", err)
-	}
-
-	// Debug: Log parsed response
-	config.DebugLog("📦 Parsed token response: %+v", tokenResp)
-
-	// Check if we got a valid access token
-	if tokenResp.AccessToken == "" {
-		config.DebugLog("❌ No access token received")
-		return nil, fmt.Errorf("no access token received")
-	}
-
-	// Convert to TokenResponseData format
-	tokenData := &models.TokenResponseData{
-		AccessToken:      tokenResp.AccessToken,
-		ExpiresIn:        tokenResp.ExpiresIn,
-		OpenID:           tokenResp.OpenID,
-		RefreshToken:     tokenResp.RefreshToken,
-		RefreshExpiresIn: tokenResp.RefreshExpiresIn,
+		return nil, err
 	}
 
+	s.log(ctx).Debug("✅ Token received", "open_id", tokenData.OpenID, "scope", tokenData.Scope, "expires_in", tokenData.ExpiresIn)
 	return tokenData, nil
 }
 
-// FetchUserInfo fetches user information from TikTok API
-func FetchUserInfo(accessToken string) (*models.UserInfo, error) {
-	// Create HTTP client
-	client := utils.NewHTTPClient("https://open.tiktokapis.com")
+// User info fields grouped by the scope that grants access to them
+var userInfoFieldsByScope = map[string][]string{
+	"user.info.basic":   {"open_id", "union_id", "avatar_url", "avatar_url_100", "avatar_large_url", "display_name"},
+	"user.info.profile": {"bio_description", "profile_deep_link", "is_verified", "username"},
+	"user.info.stats":   {"follower_count", "following_count", "likes_count", "video_count"},
+}
 
-	// Create request
-	userInfoURL := "https://open.tiktokapis.com/v2/user/info/?fields=open_id,union_id,avatar_url,avatar_url_100,avatar_large_url,display_name,bio_description,profile_deep_link,is_verified,username,follower_count,following_count,likes_count,video_count"
-	config.DebugLog("👤 Fetching user info from: %s", userInfoURL)
+// AllUserInfoFields lists every supported user info field
+var AllUserInfoFields = []string{
+	"open_id", "union_id", "avatar_url", "avatar_url_100", "avatar_large_url", "display_name",
+	"bio_description", "profile_deep_link", "is_verified", "username",
+	"follower_count", "following_count", "likes_count", "video_count",
+}
 
-	req, err := http.NewRequest("GET", userInfoURL, nil)
-	if err != nil {
-		config.DebugLog("❌ Failed to create user info request: %v", err)
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// UserInfoFieldsForScope returns the user info fields allowed by a granted scope string.
+// An empty scope falls back to the basic fields.
+func UserInfoFieldsForScope(scope string) []string {
+	fields := append([]string{}, userInfoFieldsByScope[config.BasicScope]...)
+	for _, s := range strings.Split(scope, ",") {
+		s = strings.TrimSpace(s)
+		if s == config.BasicScope {
+			continue
+		}
+		fields = append(fields, userInfoFieldsByScope[s]...)
 	}
+	return fields
+}
 
-	// Set authorization header
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	config.DebugLog("🔑 Authorization header: Bearer %s", accessToken)
-
-	// Make request
-	resp, err := client.Client.Do(req)
+// FetchUserInfo fetches the given user information fields from TikTok API
+// with the client of the app the access token was issued to
+func (s *Server) FetchUserInfo(ctx context.Context, app *config.App, accessToken string, fields []string) (*models.UserInfo, error) {
+	userInfo, err := s.tiktok(app).UserInfo(ctx, accessToken, fields...)
 	if err != nil {
-		config.DebugLog("❌ User info request failed: %v", err)
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-
-	// Debug: Log response
-	config.DebugLog("📊 User info response status: %d", resp.StatusCode)
-	config.DebugLog("📋 User info response headers: %+v", resp.Header)
-
-	// Parse response
-	var userResp models.UserInfoResponse
-	if err := utils.ReadJSONResponse(resp, &userResp); err != nil {
-		config.DebugLog("❌ Failed to parse user info response: %v", err)
-		return nil, fmt.Errorf("failed to parse user info response: %w", err)
-	}
-
-	// Debug: Log parsed response
-	config.DebugLog("📦 Parsed user info response: %+v", userResp)
-
-	// Check for API errors
-	if userResp.Error.Code != "ok" {
-		config.DebugLog("❌ TikTok User Info API error: %s - %s", userResp.Error.Code, userResp.Error.Message)
-		return nil, fmt.Errorf("TikTok API error: %s", userResp.Error.Message)
+		s.log(ctx).Debug("❌ TikTok user info request failed", "error", err)
+		return nil, err
 	}
 
-	return &userResp.Data.User, nil
+	s.log(ctx).Debug("✅ User info received", "open_id", userInfo.OpenID)
+	return userInfo, nil
 }
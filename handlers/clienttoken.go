@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/utils"
+)
+
+// ClientTokenHandler returns the current client access token of an app for internal services
+func (s *Server) ClientTokenHandler(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.requestApp(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := s.clientTokens[app.ID].Token(r.Context())
+	if err != nil {
+		writeUpstreamError(w, "Failed to get client token", err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"access_token": token.AccessToken,
+			"token_type":   token.TokenType,
+			"expires_in":   token.ExpiresIn(s.now()),
+		},
+	})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestWithClockExpiresStates(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    int
+	}{
+		{"within the state TTL", 9 * time.Minute, http.StatusOK},
+		{"past the state TTL", 11 * time.Minute, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			handler := newTestServer(t, newFakeTikTok(t), WithClock(clock.Now)).Handler()
+
+			query := authRedirect(t, handler, "/auth")
+			clock.Advance(tt.advance)
+			if status := callback(t, handler, query.Get("state")); status != tt.want {
+				t.Errorf("callback status %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
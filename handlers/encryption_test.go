@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"tiktok-oauth2/models"
+)
+
+// keySpec returns an encryption key entry filled with b
+func keySpec(id string, b byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestEncryptionKeysReloadedFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token_encryption_keys")
+	if err := os.WriteFile(path, []byte(keySpec("k1", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.Tokens.EncryptionKeysFile = path
+	s := newTestServerWithConfig(t, cfg)
+
+	if err := s.tokens.Put(models.StoredToken{OpenID: "oid", AccessToken: "act.test", RefreshToken: "rft.test"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.reloadEncryptionKeys() {
+		t.Error("keys reloaded although the file did not change")
+	}
+
+	// Rotate: add k2, which becomes primary as the last key
+	if err := os.WriteFile(path, []byte(keySpec("k1", 1)+","+keySpec("k2", 2)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !s.reloadEncryptionKeys() {
+		t.Fatal("keys not reloaded after the file changed")
+	}
+	if primary := s.encryptionKeys.Primary(); primary != "k2" {
+		t.Errorf("primary key = %q, want k2", primary)
+	}
+	if count, err := s.encrypted.Reencrypt(); err != nil || count != 1 {
+		t.Errorf("Reencrypt = %d, %v, want 1 token re-encrypted", count, err)
+	}
+
+	// An invalid file keeps the current keys
+	if err := os.WriteFile(path, []byte("not a key spec"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if s.reloadEncryptionKeys() {
+		t.Error("invalid keys were loaded")
+	}
+	token, err := s.tokens.Get("oid")
+	if err != nil {
+		t.Fatalf("token unreadable after rotation: %v", err)
+	}
+	if token.AccessToken != "act.test" {
+		t.Errorf("access token = %q, want act.test", token.AccessToken)
+	}
+}
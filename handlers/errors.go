@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/quota"
+	"tiktok-oauth2/tiktok"
+	"tiktok-oauth2/utils"
+)
+
+// statusClientClosedRequest is nginx's non-standard status for requests the client
+// gave up on; nobody reads the response, it keeps access logs from showing a 502
+const statusClientClosedRequest = 499
+
+// upstreamStatus maps an error of a TikTok API call to our response status.
+// Rejected input becomes 400, invalid access tokens 401, missing scopes 403,
+// rate limits and exhausted quotas 429, an open circuit breaker 503, timeouts 504,
+// a client that disconnected 499 and everything else (TikTok or network failures) 502.
+func upstreamStatus(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return statusClientClosedRequest
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, utils.ErrCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		return http.StatusTooManyRequests
+	}
+
+	var apiErr *tiktok.Error
+	if !errors.As(err, &apiErr) {
+		return http.StatusBadGateway
+	}
+
+	switch apiErr.Kind() {
+	case tiktok.KindBadRequest:
+		return http.StatusBadRequest
+	case tiktok.KindUnauthorized:
+		return http.StatusUnauthorized
+	case tiktok.KindForbidden:
+		return http.StatusForbidden
+	case tiktok.KindRateLimited:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// writeUpstreamError writes the response for a failed TikTok API call,
+// including TikTok's error code and log_id when available
+func writeUpstreamError(w http.ResponseWriter, message string, err error) {
+	resp := models.APIResponse{
+		Success: false,
+		Error:   message + ": " + err.Error(),
+	}
+
+	var apiErr *tiktok.Error
+	if errors.As(err, &apiErr) {
+		resp.ErrorCode = apiErr.Code
+		resp.LogID = apiErr.LogID
+	}
+	var circuitErr *utils.CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		resp.ErrorCode = "upstream_unavailable"
+		w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(circuitErr.RetryAfter), 1)))
+	}
+	var quotaErr *quota.ExceededError
+	if errors.As(err, &quotaErr) {
+		resp.ErrorCode = "quota_exceeded"
+		w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(quotaErr.RetryAfter), 1)))
+	}
+
+	utils.WriteJSONResponse(w, upstreamStatus(err), resp)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/quota"
+	"tiktok-oauth2/tiktok"
+	"tiktok-oauth2/utils"
+)
+
+func TestUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"client disconnected", fmt.Errorf("user info: %w", context.Canceled), statusClientClosedRequest},
+		{"timeout", fmt.Errorf("user info: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"circuit open", &utils.CircuitOpenError{Endpoint: "user_info"}, http.StatusServiceUnavailable},
+		{"quota exceeded", &quota.ExceededError{Endpoint: "user_info"}, http.StatusTooManyRequests},
+		{"network failure", fmt.Errorf("connection refused"), http.StatusBadGateway},
+		{"invalid_grant", &tiktok.Error{Code: tiktok.CodeInvalidGrant, StatusCode: http.StatusBadRequest}, http.StatusBadRequest},
+		{"invalid_request", &tiktok.Error{Code: tiktok.CodeInvalidRequest, StatusCode: http.StatusBadRequest}, http.StatusBadRequest},
+		{"access_token_invalid", &tiktok.Error{Code: tiktok.CodeAccessTokenInvalid, StatusCode: http.StatusOK}, http.StatusUnauthorized},
+		{"scope_not_authorized", &tiktok.Error{Code: tiktok.CodeScopeNotAuthorized, StatusCode: http.StatusOK}, http.StatusForbidden},
+		{"access_denied", &tiktok.Error{Code: tiktok.CodeAccessDenied, StatusCode: http.StatusBadRequest}, http.StatusForbidden},
+		{"rate_limit_exceeded", &tiktok.Error{Code: tiktok.CodeRateLimitExceeded, StatusCode: http.StatusOK}, http.StatusTooManyRequests},
+		{"invalid_client", &tiktok.Error{Code: tiktok.CodeInvalidClient, StatusCode: http.StatusUnauthorized}, http.StatusBadGateway},
+		{"unknown code", &tiktok.Error{Code: "something_new", StatusCode: http.StatusOK}, http.StatusBadGateway},
+		{"wrapped", fmt.Errorf("failed to refresh: %w", &tiktok.Error{Code: tiktok.CodeInvalidGrant}), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upstreamStatus(tt.err); got != tt.want {
+				t.Errorf("upstreamStatus = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserInfoErrorReachesResponse(t *testing.T) {
+	// TikTok reports API errors with status 200 and the error envelope
+	userInfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{},
+			"error": map[string]interface{}{
+				"code":    "access_token_invalid",
+				"message": "The access token is invalid or not found in the request.",
+				"log_id":  "20240101abcdef",
+			},
+		})
+	}))
+	defer userInfo.Close()
+
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.TikTok.UserInfoURL = userInfo.URL
+	s := newTestServerWithConfig(t, cfg)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Bearer act.expired")
+	s.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401, body %s", rec.Code, rec.Body)
+	}
+	var resp models.APIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrorCode != tiktok.CodeAccessTokenInvalid {
+		t.Errorf("error_code = %q, want %s", resp.ErrorCode, tiktok.CodeAccessTokenInvalid)
+	}
+	if resp.LogID != "20240101abcdef" {
+		t.Errorf("log_id = %q, want 20240101abcdef", resp.LogID)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"tiktok-oauth2/models"
+)
+
+// Hooks are callbacks for embedding applications. All hooks are optional
+// and run synchronously, so they should return quickly.
+type Hooks struct {
+	// OnLogin is called after a successful TikTok login, before the response is written
+	OnLogin func(r *http.Request, event LoginEvent)
+	// OnRefresh is called after an access token was refreshed, by a request or in the background
+	OnRefresh func(event RefreshEvent)
+	// OnError is called when a flow fails, e.g. on an invalid state or a TikTok error
+	OnError func(r *http.Request, err error)
+}
+
+// LoginEvent describes a completed TikTok login
+type LoginEvent struct {
+	AppID    string
+	Token    models.TokenResponseData
+	UserInfo models.UserInfo
+}
+
+// RefreshEvent describes a refreshed access token
+type RefreshEvent struct {
+	AppID string
+	Token models.TokenResponseData
+}
+
+// WithHooks sets the callbacks for embedding applications
+func WithHooks(hooks Hooks) Option {
+	return func(s *Server) {
+		s.hooks = hooks
+	}
+}
+
+// onLogin runs the OnLogin hook if set
+func (s *Server) onLogin(r *http.Request, event LoginEvent) {
+	if s.hooks.OnLogin != nil {
+		s.hooks.OnLogin(r, event)
+	}
+}
+
+// onRefresh runs the OnRefresh hook if set
+func (s *Server) onRefresh(event RefreshEvent) {
+	if s.hooks.OnRefresh != nil {
+		s.hooks.OnRefresh(event)
+	}
+}
+
+// onError runs the OnError hook if set
+func (s *Server) onError(r *http.Request, err error) {
+	if s.hooks.OnError != nil {
+		s.hooks.OnError(r, err)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"tiktok-oauth2/jwt"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/utils"
+)
+
+// JWKSHandler publishes the public keys used to sign our JWTs
+func (s *Server) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	if s.jwtSigner == nil {
+		utils.WriteJSONResponse(w, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Error:   "JWT issuing is disabled",
+		})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSONResponse(w, http.StatusOK, s.jwtSigner.JWKS())
+}
+
+// issueJWT mints a JWT for the logged in user, returning "" when disabled or on failure
+func (s *Server) issueJWT(ctx context.Context, tokenData *models.TokenResponseData, userInfo *models.UserInfo) string {
+	if s.jwtSigner == nil {
+		return ""
+	}
+
+	now := s.now()
+	token, err := s.jwtSigner.Sign(jwt.Claims{
+		Subject:   tokenData.OpenID,
+		Audience:  jwt.Audience{s.cfg.JWT.Audience},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.jwtSigner.TTL()).Unix(),
+		OpenID:    tokenData.OpenID,
+		UnionID:   userInfo.UnionID,
+		Username:  userInfo.Username,
+		Scope:     strings.ReplaceAll(tokenData.Scope, ",", " "),
+	})
+	if err != nil {
+		s.log(ctx).Warn("⚠️ Failed to sign JWT", "error", err)
+		return ""
+	}
+	return token
+}
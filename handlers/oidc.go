@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"tiktok-oauth2/jwt"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/oidc"
+	"tiktok-oauth2/utils"
+)
+
+// oauthError is a standard OAuth 2.0 error body
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OIDCDiscoveryHandler serves /.well-known/openid-configuration
+func (s *Server) OIDCDiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.oidcEnabled(w) {
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, oidc.NewDiscovery(s.publicURL, s.jwtSigner.Algorithm()))
+}
+
+// OIDCAuthorizeHandler validates a relying party request and starts the TikTok login for it
+func (s *Server) OIDCAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.oidcEnabled(w) {
+		return
+	}
+
+	query := r.URL.Query()
+
+	// Client and redirect URI errors must not redirect
+	client, ok := s.oidcClients[query.Get("client_id")]
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, oauthError{"invalid_client", "Unknown client_id"})
+		return
+	}
+	redirectURI := query.Get("redirect_uri")
+	if !client.ValidRedirectURI(redirectURI) {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, oauthError{"invalid_request", "redirect_uri is not registered for this client"})
+		return
+	}
+
+	request := &models.OIDCRequest{
+		ClientID:            client.ID,
+		RedirectURI:         redirectURI,
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	if query.Get("response_type") != "code" {
+		redirectOIDCError(w, r, request, "unsupported_response_type", "Only response_type=code is supported")
+		return
+	}
+
+	scope := query.Get("scope")
+	if !oidc.HasScope(scope, oidc.ScopeOpenID) {
+		redirectOIDCError(w, r, request, "invalid_scope", "The openid scope is required")
+		return
+	}
+	request.Scope = oidc.ScopeOpenID
+	if oidc.HasScope(scope, oidc.ScopeProfile) {
+		request.Scope += " " + oidc.ScopeProfile
+	}
+
+	// Only S256; plain (also the default for an empty method) exposes the verifier in the redirect
+	if request.CodeChallenge != "" && request.CodeChallengeMethod != utils.CodeChallengeMethodS256 {
+		redirectOIDCError(w, r, request, "invalid_request", "code_challenge_method must be S256")
+		return
+	}
+	if client.Public() && request.CodeChallenge == "" {
+		redirectOIDCError(w, r, request, "invalid_request", "PKCE is required for public clients")
+		return
+	}
+
+	app, ok := s.app(client.App)
+	if !ok {
+		redirectOIDCError(w, r, request, "server_error", "Client is configured for an unknown app")
+		return
+	}
+
+	s.log(r.Context()).Debug("🪪 OIDC authorization request", "client_id", client.ID)
+	s.startAuthFlow(w, r, app, models.AuthState{OIDC: request}, oidc.TikTokScopes(request.Scope), s.cfg.OAuth.PKCEEnabled)
+}
+
+// completeOIDCAuthorization issues an authorization code and redirects back to the relying party
+func (s *Server) completeOIDCAuthorization(w http.ResponseWriter, r *http.Request, request *models.OIDCRequest, tokenData *models.TokenResponseData, userInfo *models.UserInfo) {
+	code, err := s.oidcCodes.Issue(oidc.Grant{
+		Request:  *request,
+		OpenID:   tokenData.OpenID,
+		Scope:    request.Scope,
+		UserInfo: *userInfo,
+		AuthTime: s.now().Unix(),
+	})
+	if err != nil {
+		s.log(r.Context()).Error("❌ Failed to issue OIDC authorization code", "error", err)
+		redirectOIDCError(w, r, request, "server_error", "Failed to issue authorization code")
+		return
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	redirectToClient(w, r, request.RedirectURI, params)
+}
+
+// OIDCTokenHandler exchanges an authorization code for an access token and ID token
+func (s *Server) OIDCTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.oidcEnabled(w) {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, oauthError{"invalid_request", "Invalid form body"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, oauthError{"unsupported_grant_type", "Only authorization_code is supported"})
+		return
+	}
+
+	// Authenticate the client (client_secret_basic, client_secret_post or none)
+	clientID, clientSecret, basic := r.BasicAuth()
+	if !basic {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	client, ok := s.oidcClients[clientID]
+	if !ok || !client.Authenticate(clientSecret) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		}
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, oauthError{"invalid_client", "Client authentication failed"})
+		return
+	}
+
+	grant, err := s.oidcCodes.Redeem(r.PostForm.Get("code"))
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, oauthError{"invalid_grant", err.Error()})
+		return
+	}
+	if grant.Request.ClientID != client.ID || grant.Request.RedirectURI != r.PostForm.Get("redirect_uri") {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, oauthError{"invalid_grant", "Code was issued to another client or redirect_uri"})
+		return
+	}
+	if !oidc.VerifyCodeChallenge(grant.Request.CodeChallenge, grant.Request.CodeChallengeMethod, r.PostForm.Get("code_verifier")) {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, oauthError{"invalid_grant", "PKCE verification failed"})
+		return
+	}
+
+	now := s.now()
+	expiresAt := now.Add(s.jwtSigner.TTL()).Unix()
+
+	accessToken, err := s.jwtSigner.Sign(jwt.Claims{
+		Issuer:    s.publicURL,
+		Subject:   grant.OpenID,
+		Audience:  jwt.Audience{client.ID},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt,
+		ClientID:  client.ID,
+		OpenID:    grant.OpenID,
+		Scope:     grant.Scope,
+	})
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, oauthError{"server_error", "Failed to sign access token"})
+		return
+	}
+
+	idToken, err := s.jwtSigner.SignPayload(oidc.IDTokenClaims{
+		Issuer:     s.publicURL,
+		Audience:   jwt.Audience{client.ID},
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  expiresAt,
+		AuthTime:   grant.AuthTime,
+		Nonce:      grant.Request.Nonce,
+		UserClaims: oidc.ClaimsFromUserInfo(grant.OpenID, grant.UserInfo, grant.Scope),
+	})
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, oauthError{"server_error", "Failed to sign ID token"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   expiresAt - now.Unix(),
+		"id_token":     idToken,
+		"scope":        grant.Scope,
+	})
+}
+
+// OIDCUserInfoHandler returns OIDC claims for an access token issued by /oauth2/token
+func (s *Server) OIDCUserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.oidcEnabled(w) {
+		return
+	}
+
+	token := extractBearerToken(r.Header.Get("Authorization"))
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, oauthError{"invalid_request", "Bearer token required"})
+		return
+	}
+
+	claims, err := jwt.NewVerifier(s.jwtSigner.JWKS(), s.publicURL).WithClock(s.now).Verify(token)
+	if err != nil || claims.ClientID == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, oauthError{"invalid_token", "Access token is invalid or expired"})
+		return
+	}
+
+	// Fetch fresh user info with the stored TikTok token
+	tikTokToken, err := s.ValidToken(r.Context(), claims.Subject)
+	if err != nil {
+		s.log(r.Context()).Debug("❌ No valid TikTok token", "open_id", claims.Subject, "error", err)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, oauthError{"invalid_token", "The TikTok authorization is no longer valid"})
+		return
+	}
+	app := s.accessTokenApp(tikTokToken.AccessToken, s.defaultApp)
+	userInfo, err := s.FetchUserInfo(r.Context(), app, tikTokToken.AccessToken, UserInfoFieldsForScope(tikTokToken.Scope))
+	if err != nil {
+		switch upstreamStatus(err) {
+		case http.StatusUnauthorized:
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			utils.WriteJSONResponse(w, http.StatusUnauthorized, oauthError{"invalid_token", "The TikTok authorization is no longer valid"})
+		case http.StatusForbidden:
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			utils.WriteJSONResponse(w, http.StatusForbidden, oauthError{"insufficient_scope", "The TikTok authorization lacks a required scope"})
+		default:
+			utils.WriteJSONResponse(w, http.StatusBadGateway, oauthError{"server_error", "Failed to fetch user info"})
+		}
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, oidc.ClaimsFromUserInfo(claims.Subject, *userInfo, claims.Scope))
+}
+
+// redirectOIDCError redirects an authorization error back to the relying party
+func redirectOIDCError(w http.ResponseWriter, r *http.Request, request *models.OIDCRequest, code, description string) {
+	params := url.Values{}
+	params.Set("error", code)
+	params.Set("error_description", description)
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	redirectToClient(w, r, request.RedirectURI, params)
+}
+
+// redirectToClient redirects to a registered redirect URI with extra query parameters
+func redirectToClient(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, redirectURI+separator+params.Encode(), http.StatusFound)
+}
+
+// oidcEnabled writes a 404 and returns false when no relying parties are configured
+func (s *Server) oidcEnabled(w http.ResponseWriter) bool {
+	if len(s.oidcClients) == 0 || s.jwtSigner == nil {
+		utils.WriteJSONResponse(w, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Error:   "OpenID Connect is not configured",
+		})
+		return false
+	}
+	return true
+}
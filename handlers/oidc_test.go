@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"tiktok-oauth2/jwt"
+	"tiktok-oauth2/oidc"
+	"tiktok-oauth2/utils"
+	"time"
+)
+
+const rpRedirectURI = "https://rp.example.com/cb"
+
+// newOIDCServer returns a handler with a public client "spa" and a confidential client "web"
+func newOIDCServer(t *testing.T) http.Handler {
+	t.Helper()
+	tikTok := newFakeTikTok(t)
+	cfg := testConfig(tikTok)
+	cfg.OIDC.Clients = []oidc.Client{
+		{ID: "spa", RedirectURIs: []string{rpRedirectURI}},
+		{ID: "web", Secret: "web-secret", RedirectURIs: []string{rpRedirectURI}},
+	}
+	signer, err := jwt.GenerateSigner("https://auth.example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestServerWithConfig(t, cfg, WithJWTSigner(signer)).Handler()
+}
+
+// oidcCode runs the authorization request and TikTok login and returns the issued code
+func oidcCode(t *testing.T, handler http.Handler, clientID, challenge string) string {
+	t.Helper()
+	query := url.Values{
+		"client_id":     {clientID},
+		"redirect_uri":  {rpRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+	}
+	if challenge != "" {
+		query.Set("code_challenge", challenge)
+		query.Set("code_challenge_method", utils.CodeChallengeMethodS256)
+	}
+	tikTok := authRedirect(t, handler, "/oauth2/authorize?"+query.Encode())
+	back := authRedirect(t, handler, "/callback?code=auth-code&state="+url.QueryEscape(tikTok.Get("state")))
+	if back.Get("code") == "" {
+		t.Fatalf("no code in the redirect to the relying party: %v", back)
+	}
+	return back.Get("code")
+}
+
+// oidcToken posts to /oauth2/token and returns the response
+func oidcToken(t *testing.T, handler http.Handler, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	form.Set("grant_type", "authorization_code")
+	form.Set("redirect_uri", rpRedirectURI)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOIDCAuthorizeAcceptsOnlyS256(t *testing.T) {
+	handler := newOIDCServer(t)
+
+	tests := []struct {
+		name      string
+		method    string
+		wantError string
+	}{
+		{"S256", "S256", ""},
+		{"plain", "plain", "invalid_request"},
+		{"missing method defaults to plain", "", "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{
+				"client_id":      {"spa"},
+				"redirect_uri":   {rpRedirectURI},
+				"response_type":  {"code"},
+				"scope":          {"openid"},
+				"code_challenge": {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGKSx-cM"},
+			}
+			if tt.method != "" {
+				query.Set("code_challenge_method", tt.method)
+			}
+			redirect := authRedirect(t, handler, "/oauth2/authorize?"+query.Encode())
+			if got := redirect.Get("error"); got != tt.wantError {
+				t.Errorf("error = %q, want %q", got, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestVerifyCodeChallengeRejectsPlain(t *testing.T) {
+	if oidc.VerifyCodeChallenge("verifier", "plain", "verifier") {
+		t.Error("plain challenge accepted")
+	}
+	if oidc.VerifyCodeChallenge("verifier", "", "verifier") {
+		t.Error("challenge without a method accepted")
+	}
+}
+
+func TestOIDCTokenVerifiesPKCE(t *testing.T) {
+	verifier, err := utils.GenerateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := utils.CodeChallengeS256(verifier)
+
+	tests := []struct {
+		name      string
+		client    url.Values
+		challenge string
+		verifier  string
+		want      int
+	}{
+		{"matching verifier", url.Values{"client_id": {"spa"}}, challenge, verifier, http.StatusOK},
+		{"wrong verifier", url.Values{"client_id": {"spa"}}, challenge, verifier + "x", http.StatusBadRequest},
+		{"challenge as verifier", url.Values{"client_id": {"spa"}}, challenge, challenge, http.StatusBadRequest},
+		{"missing verifier", url.Values{"client_id": {"spa"}}, challenge, "", http.StatusBadRequest},
+		{"confidential client without PKCE", url.Values{"client_id": {"web"}, "client_secret": {"web-secret"}}, "", "", http.StatusOK},
+		{"confidential client with PKCE", url.Values{"client_id": {"web"}, "client_secret": {"web-secret"}}, challenge, verifier, http.StatusOK},
+		{"confidential client with wrong verifier", url.Values{"client_id": {"web"}, "client_secret": {"web-secret"}}, challenge, "wrong", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newOIDCServer(t)
+			form := url.Values{"code": {oidcCode(t, handler, tt.client.Get("client_id"), tt.challenge)}}
+			for key, values := range tt.client {
+				form[key] = values
+			}
+			if tt.verifier != "" {
+				form.Set("code_verifier", tt.verifier)
+			}
+
+			rec := oidcToken(t, handler, form)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if idToken, _ := body["id_token"].(string); tt.want == http.StatusOK && idToken == "" {
+				t.Errorf("no id_token in %s", rec.Body)
+			}
+			if tt.want == http.StatusBadRequest && body["error"] != "invalid_grant" {
+				t.Errorf("error = %v, want invalid_grant", body["error"])
+			}
+		})
+	}
+}
+
+func TestOIDCCodeBurnedByFailedPKCE(t *testing.T) {
+	verifier, err := utils.GenerateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newOIDCServer(t)
+	code := oidcCode(t, handler, "spa", utils.CodeChallengeS256(verifier))
+
+	if rec := oidcToken(t, handler, url.Values{"client_id": {"spa"}, "code": {code}, "code_verifier": {"guess"}}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("wrong verifier: status %d, want 400", rec.Code)
+	}
+	// The code was redeemed by the failed attempt, the right verifier cannot use it anymore
+	if rec := oidcToken(t, handler, url.Values{"client_id": {"spa"}, "code": {code}, "code_verifier": {verifier}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("retry after a failed verifier: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/utils"
+)
+
+func TestStartAuthFlowStoresVerifierWithState(t *testing.T) {
+	s := newTestServer(t, newFakeTikTok(t))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+	s.startAuthFlow(rec, req, s.defaultApp, models.AuthState{}, []string{config.BasicScope}, true)
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	query := location.Query()
+
+	stored, err := s.states.Consume(query.Get("state"))
+	if err != nil {
+		t.Fatalf("state not stored: %v", err)
+	}
+	if stored.CodeVerifier == "" {
+		t.Fatal("code verifier not stored with the state")
+	}
+	if got, want := query.Get("code_challenge"), utils.CodeChallengeS256(stored.CodeVerifier); got != want {
+		t.Errorf("code_challenge = %q, want S256 of the stored verifier %q", got, want)
+	}
+}
+
+func TestAuthWithPKCESendsS256Challenge(t *testing.T) {
+	s := newTestServer(t, newFakeTikTok(t))
+
+	query := authRedirect(t, s.Handler(), "/auth?pkce=true")
+	if query.Get("code_challenge") == "" {
+		t.Fatal("code_challenge missing from the authorization URL")
+	}
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", got)
+	}
+}
+
+func TestCallbackSendsMatchingCodeVerifier(t *testing.T) {
+	tikTok := newFakeTikTok(t)
+	s := newTestServer(t, tikTok)
+	handler := s.Handler()
+
+	query := authRedirect(t, handler, "/auth?pkce=true")
+	if status := callback(t, handler, query.Get("state")); status != http.StatusOK {
+		t.Fatalf("callback status %d", status)
+	}
+
+	forms := tikTok.tokenForms()
+	if len(forms) != 1 {
+		t.Fatalf("got %d token requests, want 1", len(forms))
+	}
+	verifier := forms[0].Get("code_verifier")
+	if verifier == "" {
+		t.Fatal("code_verifier missing from the token exchange")
+	}
+	if got := utils.CodeChallengeS256(verifier); got != query.Get("code_challenge") {
+		t.Errorf("code_verifier does not match the challenge: S256 = %q, challenge %q", got, query.Get("code_challenge"))
+	}
+	if got := forms[0].Get("code"); got != "auth-code" {
+		t.Errorf("code = %q, want auth-code", got)
+	}
+}
+
+func TestAuthWithoutPKCESendsNoVerifier(t *testing.T) {
+	tikTok := newFakeTikTok(t)
+	s := newTestServer(t, tikTok)
+	handler := s.Handler()
+
+	query := authRedirect(t, handler, "/auth?pkce=false")
+	if query.Has("code_challenge") || query.Has("code_challenge_method") {
+		t.Errorf("authorization URL has a PKCE challenge: %v", query)
+	}
+	if status := callback(t, handler, query.Get("state")); status != http.StatusOK {
+		t.Fatalf("callback status %d", status)
+	}
+
+	forms := tikTok.tokenForms()
+	if len(forms) != 1 {
+		t.Fatalf("got %d token requests, want 1", len(forms))
+	}
+	if forms[0].Has("code_verifier") {
+		t.Errorf("token exchange sent code_verifier %q without PKCE", forms[0].Get("code_verifier"))
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/quota"
+	"tiktok-oauth2/utils"
+)
+
+// QuotaHandler reports the current TikTok API usage of every app per endpoint,
+// so approaching a quota is visible before TikTok returns rate_limit_exceeded
+func (s *Server) QuotaHandler(w http.ResponseWriter, r *http.Request) {
+	usage := make(map[string][]quota.Usage, len(s.clients))
+	for id, client := range s.clients {
+		usage[id] = client.Usage()
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    usage,
+	})
+}
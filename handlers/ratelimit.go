@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/ratelimit"
+	"tiktok-oauth2/utils"
+	"time"
+)
+
+// RateLimit limits requests to a named route (auth, callback, refresh, revoke, user) per client.
+// Routes without a configured limit, or all routes when rate limiting is disabled, pass through.
+func (s *Server) RateLimit(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := s.cfg.RateLimit.Routes[route]
+		if s.rateLimits == nil || !ok {
+			next(w, r)
+			return
+		}
+
+		key := route + ":" + s.rateLimitKey(r, limit.Key)
+		result, err := s.rateLimits.Take(r.Context(), key, ratelimit.Limit{
+			Requests: limit.Requests,
+			Per:      limit.Per.Duration(),
+			Burst:    limit.Burst,
+		})
+		if err != nil {
+			// Fail open, a broken backend must not take the login down
+			s.log(r.Context()).Warn("⚠️ Rate limit backend failed, allowing request", "route", route, "error", err)
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+			utils.WriteJSONResponse(w, http.StatusTooManyRequests, models.APIResponse{
+				Success: false,
+				Error:   "Too many requests, please retry later",
+			})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// rateLimitKey returns what a request is counted by. Only verified identities get their own
+// bucket: api_key needs the configured admin key, open_id a valid session or a stored access
+// token. Everything else is counted by the client IP, so made-up keys cannot mint buckets.
+func (s *Server) rateLimitKey(r *http.Request, key string) string {
+	switch key {
+	case config.RateLimitKeyAPIKey:
+		if s.validAPIKey(r) {
+			return "key:" + hashKey(r.Header.Get("X-API-Key"))
+		}
+	case config.RateLimitKeyOpenID:
+		if s.sessions != nil {
+			if sess, err := s.sessions.Get(r); err == nil {
+				return "open_id:" + sess.OpenID
+			}
+		}
+		// A bearer token identifies one account when we issued it, without a TikTok call
+		if token := extractBearerToken(r.Header.Get("Authorization")); token != "" {
+			if stored, err := s.tokenIndex.FindByAccessToken(token); err == nil {
+				return "open_id:" + stored.OpenID
+			}
+		}
+	}
+	return "ip:" + s.clientIP(r)
+}
+
+// clientIP returns the client address. When the proxy is trusted it is the rightmost
+// X-Forwarded-For hop that is not a trusted proxy; entries further left are set by the
+// client and are ignored.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !s.cfg.RateLimit.TrustProxy {
+		return host
+	}
+	// With trusted proxies configured, only requests coming through one of them are forwarded
+	if len(s.trustedProxies) > 0 && !s.trustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			return host
+		}
+		if i > 0 && s.trustedProxy(hop) {
+			continue
+		}
+		return hop
+	}
+	return host
+}
+
+// trustedProxy reports whether an address belongs to a configured trusted proxy
+func (s *Server) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashKey shortens a secret so it can be used as a bucket key without being stored
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"time"
+)
+
+func TestClientIPIgnoresClientControlledHops(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"rightmost hop without trusted proxies", nil, "10.0.0.1:1234", "6.6.6.6, 1.2.3.4", "1.2.3.4"},
+		{"trusted hops are skipped", []string{"10.0.0.0/8"}, "10.0.0.1:1234", "6.6.6.6, 1.2.3.4, 10.0.0.2", "1.2.3.4"},
+		{"untrusted peer is not forwarded", []string{"10.0.0.0/8"}, "5.5.5.5:1234", "6.6.6.6", "5.5.5.5"},
+		{"invalid hop falls back to the peer", nil, "10.0.0.1:1234", "garbage", "10.0.0.1"},
+		{"no header", nil, "10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, newFakeTikTok(t), func(s *Server) {
+				s.cfg.RateLimit.TrustProxy = true
+				s.cfg.RateLimit.TrustedProxies = tt.trusted
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := s.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitKeyNeedsVerifiedIdentity(t *testing.T) {
+	s := newTestServer(t, newFakeTikTok(t))
+	s.cfg.Server.AdminAPIKey = "admin"
+	if err := s.tokens.Put(models.NewStoredToken(config.DefaultAppID, models.TokenResponseData{
+		AccessToken: "act.stored",
+		OpenID:      "oid",
+		ExpiresIn:   3600,
+	}, time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		header string
+		value  string
+		want   string
+	}{
+		{"unknown bearer token", config.RateLimitKeyOpenID, "Authorization", "Bearer act.random", "ip:192.0.2.1"},
+		{"stored bearer token", config.RateLimitKeyOpenID, "Authorization", "Bearer act.stored", "open_id:oid"},
+		{"unknown api key", config.RateLimitKeyAPIKey, "X-API-Key", "random", "ip:192.0.2.1"},
+		{"admin api key", config.RateLimitKeyAPIKey, "X-API-Key", "admin", "key:" + hashKey("admin")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			req.Header.Set(tt.header, tt.value)
+			if got := s.rateLimitKey(req, tt.key); got != tt.want {
+				t.Errorf("rateLimitKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/store"
+	"tiktok-oauth2/utils"
+)
+
+// RevokeHandler revokes an account's access at TikTok and removes it from local storage.
+// The token is taken from the body or the Authorization header; revoking a stored
+// account by open_id alone requires the X-API-Key header.
+func (s *Server) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AccessToken string `json:"access_token"`
+		OpenID      string `json:"open_id"`
+	}
+
+	if r.ContentLength != 0 {
+		if err := utils.ReadJSONResponse(&http.Response{Body: r.Body}, &req); err != nil {
+			utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+	}
+
+	if req.AccessToken == "" {
+		req.AccessToken = extractBearerToken(r.Header.Get("Authorization"))
+	}
+
+	// Look up the stored token when only the open_id is known
+	var stored *models.StoredToken
+	if req.AccessToken == "" {
+		if req.OpenID == "" {
+			utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "access_token or open_id is required",
+			})
+			return
+		}
+		if !s.validAPIKey(r) {
+			utils.WriteJSONResponse(w, http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Error:   "Revoking by open_id requires a valid API key",
+			})
+			return
+		}
+
+		var err error
+		stored, err = s.tokens.Get(req.OpenID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrTokenNotFound) {
+				status = http.StatusNotFound
+			}
+			utils.WriteJSONResponse(w, status, models.APIResponse{
+				Success: false,
+				Error:   "Failed to find stored token: " + err.Error(),
+			})
+			return
+		}
+		req.AccessToken = stored.AccessToken
+	} else {
+		// Only the account that owns the token is removed locally
+		stored = s.findStoredToken(req.AccessToken)
+	}
+
+	// Revoke with the app the token belongs to
+	var openID string
+	app, ok := s.requestApp(w, r)
+	if !ok {
+		return
+	}
+	if stored != nil {
+		openID = stored.OpenID
+		storedApp, err := s.storedTokenApp(stored)
+		if err != nil {
+			utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		app = storedApp
+	}
+
+	// Revoke at TikTok
+	if err := s.RevokeAccessToken(r.Context(), app, req.AccessToken); err != nil {
+		s.log(r.Context()).Warn("❌ Token revocation failed", "app", app.ID, "error", err)
+		s.onError(r, fmt.Errorf("failed to revoke token: %w", err))
+		writeUpstreamError(w, "Failed to revoke token", err)
+		return
+	}
+
+	// Remove the account locally
+	result := models.RevokeResult{
+		OpenID:  openID,
+		Revoked: true,
+	}
+	if openID != "" {
+		if s.scheduler != nil {
+			s.scheduler.Forget(openID)
+		}
+		if s.sessions != nil {
+			s.sessions.DestroyAccount(openID)
+		}
+		if err := s.tokens.Delete(openID); err == nil {
+			result.RemovedFromStore = true
+		} else if !errors.Is(err, store.ErrTokenNotFound) {
+			s.log(r.Context()).Warn("⚠️ Failed to remove stored token", "open_id", openID, "error", err)
+		}
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Token revoked successfully",
+		Data:    result,
+	})
+}
+
+// RevokeAccessToken revokes an app's access token at TikTok
+func (s *Server) RevokeAccessToken(ctx context.Context, app *config.App, accessToken string) error {
+	s.log(ctx).Debug("🔄 Revoking token", "app", app.ID)
+	return s.tiktok(app).Revoke(ctx, accessToken)
+}
+
+// findStoredToken returns the stored account with this access token, or nil
+func (s *Server) findStoredToken(accessToken string) *models.StoredToken {
+	token, err := s.tokenIndex.FindByAccessToken(accessToken)
+	if err != nil {
+		return nil
+	}
+	return token
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Handler returns the HTTP handler serving all endpoints of the server
+func (s *Server) Handler() http.Handler {
+	router := mux.NewRouter()
+
+	// Add CORS middleware
+	router.Use(corsMiddleware)
+
+	// Health check endpoint
+	router.HandleFunc("/health", s.HealthHandler).Methods("GET")
+	router.HandleFunc("/.well-known/jwks.json", s.JWKSHandler).Methods("GET")
+
+	// OpenID Connect endpoints
+	router.HandleFunc("/.well-known/openid-configuration", s.OIDCDiscoveryHandler).Methods("GET")
+	router.HandleFunc("/oauth2/authorize", s.OIDCAuthorizeHandler).Methods("GET")
+	router.HandleFunc("/oauth2/token", s.OIDCTokenHandler).Methods("POST")
+	router.HandleFunc("/userinfo", s.OIDCUserInfoHandler).Methods("GET", "POST")
+
+	// OAuth endpoints
+	router.HandleFunc("/auth", s.RateLimit("auth", s.AuthHandler)).Methods("GET")
+	router.HandleFunc("/callback", s.RateLimit("callback", s.CallbackHandler)).Methods("GET")
+	router.HandleFunc("/refresh", s.RateLimit("refresh", s.RefreshTokenHandler)).Methods("POST")
+	router.HandleFunc("/revoke", s.RateLimit("revoke", s.RevokeHandler)).Methods("POST")
+	router.HandleFunc("/user", s.RateLimit("user", s.UserInfoHandler)).Methods("GET")
+	router.HandleFunc("/logout", s.LogoutHandler).Methods("POST")
+
+	// Per-app OAuth endpoints
+	router.HandleFunc("/apps/{app}/auth", appRoute(s.RateLimit("auth", s.AuthHandler))).Methods("GET")
+	router.HandleFunc("/apps/{app}/callback", appRoute(s.RateLimit("callback", s.CallbackHandler))).Methods("GET")
+	router.HandleFunc("/apps/{app}/refresh", appRoute(s.RateLimit("refresh", s.RefreshTokenHandler))).Methods("POST")
+	router.HandleFunc("/apps/{app}/revoke", appRoute(s.RateLimit("revoke", s.RevokeHandler))).Methods("POST")
+	router.HandleFunc("/apps/{app}/user", appRoute(s.RateLimit("user", s.UserInfoHandler))).Methods("GET")
+	router.HandleFunc("/apps/{app}/client-token", appRoute(s.RequireAPIKey(s.ClientTokenHandler))).Methods("GET")
+
+	// Internal token endpoints (X-API-Key required)
+	router.HandleFunc("/tokens", s.RequireAPIKey(s.ListTokensHandler)).Methods("GET")
+	router.HandleFunc("/tokens/{open_id}", s.RequireAPIKey(s.GetTokenHandler)).Methods("GET")
+	router.HandleFunc("/tokens/{open_id}", s.RequireAPIKey(s.DeleteTokenHandler)).Methods("DELETE")
+	router.HandleFunc("/refresh/failures", s.RequireAPIKey(s.RefreshFailuresHandler)).Methods("GET")
+	router.HandleFunc("/ticket/redeem", s.RequireAPIKey(s.TicketRedeemHandler)).Methods("POST")
+	router.HandleFunc("/internal/client-token", s.RequireAPIKey(s.ClientTokenHandler)).Methods("GET")
+	router.HandleFunc("/internal/quota", s.RequireAPIKey(s.QuotaHandler)).Methods("GET")
+
+	return s.LogRequests(router)
+}
+
+// HealthHandler provides a simple health check endpoint
+func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	// TikTok being unreachable degrades the service but does not make it unhealthy
+	status := "healthy"
+	breakers := s.client.BreakerStatus()
+	for _, breaker := range breakers {
+		if breaker.State != utils.BreakerClosed {
+			status = "degraded"
+		}
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "TikTok OAuth2 Server is running",
+		Data: map[string]interface{}{
+			"status":  status,
+			"version": "1.0.0",
+			"upstream": map[string]interface{}{
+				"retries":  s.client.RetryStats(),
+				"breakers": breakers,
+			},
+		},
+	})
+}
+
+// corsMiddleware adds CORS headers to responses
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
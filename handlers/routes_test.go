@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/utils"
+	"time"
+)
+
+func TestHealthReportsRetries(t *testing.T) {
+	var calls atomic.Int32
+	userInfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":  map[string]interface{}{"user": map[string]interface{}{"open_id": "oid"}},
+			"error": map[string]interface{}{"code": "ok"},
+		})
+	}))
+	defer userInfo.Close()
+
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.TikTok.UserInfoURL = userInfo.URL
+	cfg.Upstream.Retry.BaseDelay = config.Duration(time.Millisecond)
+	cfg.Upstream.Retry.MaxDelay = config.Duration(time.Millisecond)
+	handler := newTestServerWithConfig(t, cfg).Handler()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("Authorization", "Bearer act.user")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health struct {
+		Data struct {
+			Upstream struct {
+				Retries utils.RetryStats `json:"retries"`
+			} `json:"upstream"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if got := health.Data.Upstream.Retries; got.Calls != 1 || got.Retries != 1 || got.Exhausted != 0 {
+		t.Errorf("health retries = %+v, want 1 call with 1 retry", got)
+	}
+}
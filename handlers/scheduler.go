@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/scheduler"
+	"tiktok-oauth2/utils"
+)
+
+// RefreshFailuresHandler lists accounts whose background refresh failed.
+// With ?reconsent=true only accounts that need the user to log in again are returned.
+func (s *Server) RefreshFailuresHandler(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		utils.WriteJSONResponse(w, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Error:   "Automatic token refresh is disabled",
+		})
+		return
+	}
+
+	reconsentOnly := r.URL.Query().Get("reconsent") == "true"
+	failures := []scheduler.Failure{}
+	for _, failure := range s.scheduler.Failures() {
+		if reconsentOnly && !failure.NeedsReconsent {
+			continue
+		}
+		failures = append(failures, failure)
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    failures,
+	})
+}
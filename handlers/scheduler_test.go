@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/scheduler"
+	"time"
+)
+
+// refreshFailures calls /refresh/failures with the admin key and returns the listed open_ids
+func refreshFailures(t *testing.T, handler http.Handler, query string) []string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/refresh/failures"+query, nil)
+	req.Header.Set("X-API-Key", "admin")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /refresh/failures%s: status %d, body %s", query, rec.Code, rec.Body)
+	}
+
+	var body struct {
+		Data []scheduler.Failure `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	openIDs := []string{}
+	for _, failure := range body.Data {
+		openIDs = append(openIDs, failure.OpenID)
+	}
+	return openIDs
+}
+
+func TestRefreshFailuresFiltersReconsent(t *testing.T) {
+	tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer tokenEndpoint.Close()
+
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.TikTok.TokenURL = tokenEndpoint.URL
+	cfg.Server.AdminAPIKey = "admin"
+	cfg.Tokens.AutoRefresh.Enabled = true
+	cfg.Tokens.AutoRefresh.Window = config.Duration(10 * time.Minute)
+	cfg.Tokens.AutoRefresh.Jitter = 0
+	s := newTestServerWithConfig(t, cfg, WithClock(clock.Now))
+	handler := s.Handler()
+
+	now := clock.Now()
+	for _, token := range []models.StoredToken{
+		{OpenID: "failing", RefreshToken: "rft.failing", ExpiresAt: now.Add(time.Minute).Unix(), RefreshExpiresAt: now.Add(time.Hour).Unix()},
+		{OpenID: "expired", RefreshToken: "rft.expired", ExpiresAt: now.Add(time.Minute).Unix(), RefreshExpiresAt: now.Unix()},
+		{OpenID: "healthy", RefreshToken: "rft.healthy", ExpiresAt: now.Add(time.Hour).Unix()},
+	} {
+		if err := s.tokens.Put(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.scheduler.RunOnce(context.Background())
+
+	if got := refreshFailures(t, handler, ""); len(got) != 2 || got[0] != "expired" || got[1] != "failing" {
+		t.Errorf("failures = %v, want expired and failing", got)
+	}
+	if got := refreshFailures(t, handler, "?reconsent=true"); len(got) != 1 || got[0] != "expired" {
+		t.Errorf("reconsent failures = %v, want expired", got)
+	}
+}
+
+func TestRefreshFailuresWithoutScheduler(t *testing.T) {
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.Server.AdminAPIKey = "admin"
+	handler := newTestServerWithConfig(t, cfg).Handler()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/refresh/failures", nil)
+	req.Header.Set("X-API-Key", "admin")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404 with auto refresh disabled", rec.Code)
+	}
+}
@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"tiktok-oauth2/clienttoken"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/jwt"
+	"tiktok-oauth2/keyring"
+	"tiktok-oauth2/logging"
+	"tiktok-oauth2/oidc"
+	"tiktok-oauth2/quota"
+	"tiktok-oauth2/ratelimit"
+	"tiktok-oauth2/scheduler"
+	"tiktok-oauth2/session"
+	"tiktok-oauth2/store"
+	"tiktok-oauth2/tiktok"
+	"tiktok-oauth2/utils"
+	"time"
+)
+
+// keyFilePollInterval is how often the token encryption key file is checked for changes
+const keyFilePollInterval = 30 * time.Second
+
+// Server serves the TikTok OAuth flows for one configuration.
+// All state lives on the Server, so several configurations can run in one process.
+type Server struct {
+	cfg             *config.Config
+	apps            map[string]*config.App
+	defaultApp      *config.App
+	publicURL       string
+	returnToOrigins []string
+
+	client *utils.HTTPClient
+	now    func() time.Time
+	logger *slog.Logger
+	hooks  Hooks
+
+	// clients call the TikTok API, keyed by app ID
+	clients map[string]*tiktok.Client
+	// states holds issued OAuth state parameters until the callback consumes them
+	states store.StateStore
+	// tokens persists account tokens keyed by open_id
+	tokens store.TokenStore
+	// tickets holds single-use login results for redirects back to the frontend
+	tickets store.TicketStore
+	// sessions issues session cookies, nil when session mode is disabled
+	sessions *session.Manager
+	// scheduler refreshes stored tokens in the background, nil when auto refresh is disabled
+	scheduler *scheduler.Scheduler
+	// jwtSigner issues our own JWTs after a TikTok login, nil when disabled
+	jwtSigner *jwt.Signer
+	// oidcClients are the registered relying parties, keyed by client_id
+	oidcClients map[string]oidc.Client
+	// oidcCodes holds authorization codes issued to relying parties
+	oidcCodes *oidc.CodeStore
+	// clientTokens manages the client credentials token of each app, keyed by app ID
+	clientTokens map[string]*clienttoken.Manager
+	// rateLimits keeps the inbound rate limit buckets, nil when rate limiting is disabled
+	rateLimits ratelimit.Backend
+	// trustedProxies are the proxies whose X-Forwarded-For hops are skipped
+	trustedProxies []netip.Prefix
+
+	// tokenIndex finds stored tokens by access token, it wraps the token store
+	tokenIndex *store.IndexedTokenStore
+	// encrypted is set when the token store encrypts tokens, for background re-encryption
+	encrypted *store.EncryptedTokenStore
+	// encryptionKeys is the keyring of encrypted, replaced when the key file changes
+	encryptionKeys *keyring.Keyring
+	// encryptionSpec is the key spec encryptionKeys was last loaded from
+	encryptionSpec string
+	closers        []func()
+}
+
+// Option customizes a Server
+type Option func(*Server)
+
+// WithHTTPClient sets the HTTP client used for TikTok API calls
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Server) {
+		s.client = &utils.HTTPClient{Client: client}
+	}
+}
+
+// WithStateStore sets the OAuth state store
+func WithStateStore(states store.StateStore) Option {
+	return func(s *Server) {
+		s.states = states
+	}
+}
+
+// WithTokenStore sets the account token store
+func WithTokenStore(tokens store.TokenStore) Option {
+	return func(s *Server) {
+		s.tokens = tokens
+	}
+}
+
+// WithTicketStore sets the login ticket store
+func WithTicketStore(tickets store.TicketStore) Option {
+	return func(s *Server) {
+		s.tickets = tickets
+	}
+}
+
+// WithSessions sets the session manager and enables session mode
+func WithSessions(sessions *session.Manager) Option {
+	return func(s *Server) {
+		s.sessions = sessions
+	}
+}
+
+// WithJWTSigner sets the signer for our own JWTs
+func WithJWTSigner(signer *jwt.Signer) Option {
+	return func(s *Server) {
+		s.jwtSigner = signer
+	}
+}
+
+// WithRateLimitBackend sets the rate limit backend, e.g. one shared across instances.
+// Limits are only enforced when rate limiting is enabled in the configuration.
+func WithRateLimitBackend(backend ratelimit.Backend) Option {
+	return func(s *Server) {
+		s.rateLimits = backend
+	}
+}
+
+// WithClock sets the time source of the handlers and of the stores, sessions and
+// background jobs created by New. Stores passed in with other options keep their own.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
+}
+
+// WithLogger sets the logger. Records pass through it unredacted unless it was
+// built with the logging package.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// New creates a server for a validated configuration.
+// Dependencies not given as options are built from the configuration.
+func New(cfg *config.Config, opts ...Option) (*Server, error) {
+	apps, defaultApp, err := cfg.Apps()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		cfg:             cfg,
+		apps:            apps,
+		defaultApp:      defaultApp,
+		publicURL:       cfg.EffectivePublicURL(),
+		returnToOrigins: cfg.ReturnToOrigins(),
+		client:          utils.NewHTTPClient(""),
+		now:             time.Now,
+		logger:          logging.New(cfg.Logging()),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.client.Retry = cfg.Upstream.Retry.Policy()
+	s.client.Breaker = cfg.Upstream.Breaker.Policy()
+
+	// OAuth state store
+	if s.states == nil {
+		states := store.NewMemoryStateStore(time.Minute).WithClock(s.now)
+		s.closers = append(s.closers, states.Close)
+		s.states = states
+	}
+
+	// Token store
+	if s.tokens == nil {
+		tokens, err := s.newTokenStore()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open token store: %w", err)
+		}
+		s.tokens = tokens
+	}
+	s.tokenIndex = store.NewIndexedTokenStore(s.tokens)
+	s.tokens = s.tokenIndex
+
+	// Background token refresh
+	if cfg.Tokens.AutoRefresh.Enabled {
+		autoRefresh := cfg.Tokens.AutoRefresh
+		s.scheduler = scheduler.New(s.tokens, s.RefreshStoredToken, scheduler.Config{
+			Interval:    autoRefresh.Interval.Duration(),
+			Window:      autoRefresh.Window.Duration(),
+			Jitter:      autoRefresh.Jitter.Duration(),
+			Concurrency: autoRefresh.Concurrency,
+			MaxAttempts: autoRefresh.MaxAttempts,
+			Logger:      s.logger,
+		}).WithClock(s.now)
+	}
+
+	// Inbound rate limiting
+	if !cfg.RateLimit.Enabled {
+		s.rateLimits = nil
+	} else if s.rateLimits == nil {
+		backend := ratelimit.NewMemoryBackend(time.Minute)
+		s.closers = append(s.closers, backend.Close)
+		s.rateLimits = backend
+	}
+
+	trustedProxies, err := cfg.RateLimit.TrustedProxyPrefixes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limit configuration: %w", err)
+	}
+	s.trustedProxies = trustedProxies
+
+	// Single-use tickets for redirects back to the frontend
+	if s.tickets == nil {
+		s.tickets = store.NewMemoryTicketStore(cfg.OAuth.TicketTTL.Duration()).WithClock(s.now)
+	}
+
+	// Session mode
+	if s.sessions == nil && cfg.Session.Enabled {
+		sessions, err := session.NewManager([]byte(cfg.CurrentSessionSecret()), session.Options{
+			CookieName: cfg.Session.CookieName,
+			TTL:        cfg.Session.TTL.Duration(),
+			Secure:     cfg.Session.CookieSecure,
+			Now:        s.now,
+			Secret:     func() []byte { return []byte(cfg.CurrentSessionSecret()) },
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid session configuration: %w", err)
+		}
+		s.sessions = sessions
+	}
+	if s.sessions != nil {
+		s.logger.Info("🍪 Session mode enabled - /callback sets a session cookie instead of returning tokens")
+	}
+
+	// JWT issuing
+	if s.jwtSigner == nil && cfg.JWT.Enabled {
+		signer, err := s.newJWTSigner()
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up JWT signing: %w", err)
+		}
+		s.jwtSigner = signer
+	}
+
+	// OpenID Connect facade for relying parties
+	if len(cfg.OIDC.Clients) > 0 {
+		clients, err := oidc.ClientMap(cfg.OIDC.Clients)
+		if err != nil {
+			return nil, err
+		}
+		if s.jwtSigner == nil {
+			return nil, fmt.Errorf("OpenID Connect requires JWT signing")
+		}
+		s.oidcClients = clients
+		s.oidcCodes = oidc.NewCodeStore(cfg.OIDC.CodeTTL.Duration()).WithClock(s.now)
+		s.logger.Info("🪪 OpenID Connect enabled", "clients", len(clients), "issuer", s.publicURL)
+	}
+
+	// TikTok API clients and app-level client credentials tokens
+	s.clients = make(map[string]*tiktok.Client, len(apps))
+	s.clientTokens = make(map[string]*clienttoken.Manager, len(apps))
+	for id, app := range apps {
+		s.clients[id] = tiktok.NewClient(tiktok.Config{
+			ClientKey:     app.ClientKey,
+			ClientSecrets: app.ClientSecrets,
+			Endpoints:     cfg.Endpoints(),
+			HTTPClient:    s.client,
+			Logger:        s.logger.With("app", id),
+			Quota:         quota.NewTracker(cfg.Upstream.Quota.Limits(), cfg.Upstream.Quota.MaxWait.Duration()),
+			Timeouts:      cfg.Upstream.Timeouts.Timeouts(),
+		})
+		s.clientTokens[id] = clienttoken.NewManager(s.clients[id], cfg.ClientToken.RenewBefore.Duration()).WithClock(s.now)
+	}
+
+	return s, nil
+}
+
+// Start runs the background jobs (token refresh, client token renewal, re-encryption)
+// until the context is cancelled. It returns immediately.
+func (s *Server) Start(ctx context.Context) {
+	if s.scheduler != nil {
+		go s.scheduler.Start(ctx)
+		s.logger.Info("⏰ Automatic token refresh enabled", "window", s.cfg.Tokens.AutoRefresh.Window.Duration().String())
+	}
+
+	if s.cfg.ClientToken.Prefetch {
+		for _, manager := range s.clientTokens {
+			go manager.Start(ctx)
+		}
+	}
+
+	// Re-encrypt tokens sealed with older keys, again whenever the key file changes
+	if s.encrypted != nil {
+		go s.reencrypt()
+		if s.cfg.Tokens.EncryptionKeysFile != "" {
+			go s.watchEncryptionKeys(ctx)
+		}
+	}
+}
+
+// reencrypt rewrites the tokens that are not sealed with the primary key
+func (s *Server) reencrypt() {
+	count, err := s.encrypted.Reencrypt()
+	if err != nil {
+		s.logger.Error("⚠️ Token re-encryption failed", "reencrypted", count, "error", err)
+		return
+	}
+	if count > 0 {
+		s.logger.Info("🔐 Re-encrypted tokens", "count", count)
+	}
+}
+
+// watchEncryptionKeys polls the encryption key file until the context is cancelled
+func (s *Server) watchEncryptionKeys(ctx context.Context) {
+	ticker := time.NewTicker(keyFilePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.reloadEncryptionKeys() {
+				s.reencrypt()
+			}
+		}
+	}
+}
+
+// reloadEncryptionKeys swaps in the keys from the key file when they changed and reports whether
+// it did. Invalid keys are logged once and the current keys stay in use.
+func (s *Server) reloadEncryptionKeys() bool {
+	spec := s.cfg.CurrentEncryptionKeys()
+	if spec == "" || spec == s.encryptionSpec {
+		return false
+	}
+	s.encryptionSpec = spec
+
+	keys, err := keyring.ParseKeys(spec, s.cfg.Tokens.EncryptionPrimary)
+	if err != nil {
+		s.logger.Error("⚠️ Ignoring invalid token encryption keys", "path", s.cfg.Tokens.EncryptionKeysFile, "error", err)
+		return false
+	}
+	s.encryptionKeys.Replace(keys)
+	s.logger.Info("🔐 Token encryption keys reloaded", "primary_key", keys.Primary())
+	return true
+}
+
+// Close releases resources created by New
+func (s *Server) Close() {
+	for _, closer := range s.closers {
+		closer()
+	}
+}
+
+// newTokenStore creates the configured token store, wrapped with encryption when keys are set
+func (s *Server) newTokenStore() (store.TokenStore, error) {
+	var tokenStore store.TokenStore
+	switch s.cfg.Tokens.Store {
+	case "memory":
+		tokenStore = store.NewMemoryTokenStore()
+	case "file":
+		fileStore, err := store.NewFileTokenStore(s.cfg.Tokens.Path)
+		if err != nil {
+			return nil, err
+		}
+		tokenStore = fileStore
+	default:
+		return nil, fmt.Errorf("unknown token store %q (use memory or file)", s.cfg.Tokens.Store)
+	}
+
+	spec := s.cfg.CurrentEncryptionKeys()
+	if spec == "" {
+		return tokenStore, nil
+	}
+
+	keys, err := keyring.ParseKeys(spec, s.cfg.Tokens.EncryptionPrimary)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encryption keys: %w", err)
+	}
+	s.encrypted = store.NewEncryptedTokenStore(tokenStore, keys)
+	s.encryptionKeys = keys
+	s.encryptionSpec = spec
+
+	s.logger.Info("🔐 Token encryption enabled", "primary_key", keys.Primary())
+	return s.encrypted, nil
+}
+
+// newJWTSigner loads the JWT signing key from JWT_PRIVATE_KEY_FILE
+func (s *Server) newJWTSigner() (*jwt.Signer, error) {
+	jwtConfig := s.cfg.JWT
+	if jwtConfig.PrivateKeyFile == "" {
+		return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required, a generated key would not survive restarts")
+	}
+	return jwt.LoadSigner(jwtConfig.PrivateKeyFile, jwtConfig.KeyID, jwtConfig.Issuer, jwtConfig.TTL.Duration())
+}
+
+// app returns the app with the given ID, or the default app for an empty ID
+func (s *Server) app(id string) (*config.App, bool) {
+	if id == "" {
+		return s.defaultApp, s.defaultApp != nil
+	}
+	app, ok := s.apps[id]
+	return app, ok
+}
+
+// tiktok returns the TikTok API client of an app
+func (s *Server) tiktok(app *config.App) *tiktok.Client {
+	return s.clients[app.ID]
+}
+
+// adminAPIKey returns the current admin API key, "" when internal endpoints are disabled
+func (s *Server) adminAPIKey() string {
+	return s.cfg.CurrentAdminAPIKey()
+}
+
+// log returns the request-scoped logger of ctx, or the server's logger
+func (s *Server) log(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, s.logger)
+}
+
+// LogRequests adds a request-scoped logger to each request and logs completed requests
+func (s *Server) LogRequests(next http.Handler) http.Handler {
+	return logging.Middleware(s.logger, next)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/logging"
+)
+
+// fakeTikTok serves the token and user info endpoints and records the token requests
+type fakeTikTok struct {
+	*httptest.Server
+	mu    sync.Mutex
+	forms []url.Values
+}
+
+func newFakeTikTok(t *testing.T) *fakeTikTok {
+	t.Helper()
+	f := &fakeTikTok{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("token request: %v", err)
+		}
+		f.mu.Lock()
+		f.forms = append(f.forms, r.PostForm)
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":       "act.test",
+			"expires_in":         86400,
+			"open_id":            "oid",
+			"refresh_token":      "rft.test",
+			"refresh_expires_in": 31536000,
+			"scope":              "user.info.basic",
+			"token_type":         "Bearer",
+		})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":  map[string]interface{}{"user": map[string]interface{}{"open_id": "oid"}},
+			"error": map[string]interface{}{"code": "ok"},
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// tokenForms returns the recorded token request forms
+func (f *fakeTikTok) tokenForms() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.forms...)
+}
+
+// testConfig returns the configuration of one app talking to the fake TikTok API
+func testConfig(tikTok *fakeTikTok) *config.Config {
+	cfg := config.Defaults()
+	cfg.TikTok.ClientKey = "ck"
+	cfg.TikTok.ClientSecret = "secret"
+	cfg.TikTok.TokenURL = tikTok.URL + "/token"
+	cfg.TikTok.UserInfoURL = tikTok.URL + "/user"
+	cfg.Tokens.AutoRefresh.Enabled = false
+	cfg.JWT.Enabled = false
+	cfg.RateLimit.Enabled = false
+	return cfg
+}
+
+// newTestServer creates a server for one app talking to the fake TikTok API
+func newTestServer(t *testing.T, tikTok *fakeTikTok, opts ...Option) *Server {
+	t.Helper()
+	return newTestServerWithConfig(t, testConfig(tikTok), opts...)
+}
+
+// newTestServerWithConfig creates a server for a configuration with a silent logger
+func newTestServerWithConfig(t *testing.T, cfg *config.Config, opts ...Option) *Server {
+	t.Helper()
+	s, err := New(cfg, append([]Option{WithLogger(logging.Discard())}, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// authRedirect calls /auth and returns the query of the TikTok authorization URL
+func authRedirect(t *testing.T, handler http.Handler, path string) url.Values {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("GET %s: status %d, body %s", path, rec.Code, rec.Body)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	return location.Query()
+}
+
+// callback completes the flow for a state and returns the response status
+func callback(t *testing.T, handler http.Handler, state string) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	path := "/callback?code=auth-code&state=" + url.QueryEscape(state)
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+func TestCallbackRejectsReplayedState(t *testing.T) {
+	tikTok := newFakeTikTok(t)
+	handler := newTestServer(t, tikTok).Handler()
+
+	state := authRedirect(t, handler, "/auth").Get("state")
+	if status := callback(t, handler, state); status != http.StatusOK {
+		t.Fatalf("first callback status %d, want 200", status)
+	}
+	if status := callback(t, handler, state); status != http.StatusBadRequest {
+		t.Errorf("replayed callback status %d, want 400", status)
+	}
+	if forms := tikTok.tokenForms(); len(forms) != 1 {
+		t.Errorf("TikTok received %d code exchanges, want 1", len(forms))
+	}
+}
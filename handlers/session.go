@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/session"
+	"tiktok-oauth2/utils"
+)
+
+// writeSessionResponse stores the token, starts a session and returns the user info without tokens.
+// With returnTo set the browser is redirected there instead.
+func (s *Server) writeSessionResponse(w http.ResponseWriter, r *http.Request, app *config.App, tokenData *models.TokenResponseData, userInfo *models.UserInfo, returnTo string) {
+	if err := s.tokens.Put(models.NewStoredToken(app.ID, *tokenData, s.now())); err != nil {
+		s.log(r.Context()).Error("❌ Failed to store token for session", "error", err)
+		s.onError(r, fmt.Errorf("failed to store token for session: %w", err))
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error:   "Failed to store token",
+		})
+		return
+	}
+
+	sess, err := s.sessions.Create(w, tokenData.OpenID)
+	if err != nil {
+		s.log(r.Context()).Error("❌ Failed to create session", "error", err)
+		s.onError(r, fmt.Errorf("failed to create session: %w", err))
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error:   "Failed to create session",
+		})
+		return
+	}
+
+	if returnTo != "" {
+		http.Redirect(w, r, returnTo, http.StatusFound)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Authentication successful",
+		Data: models.SessionResponse{
+			OpenID:         sess.OpenID,
+			SessionExpires: sess.Expires,
+			UserInfo:       *userInfo,
+			JWT:            s.issueJWT(r.Context(), tokenData, userInfo),
+		},
+	})
+}
+
+// sessionAccessToken returns a valid access token for the request's session
+func (s *Server) sessionAccessToken(r *http.Request) (string, error) {
+	if s.sessions == nil {
+		return "", session.ErrNoSession
+	}
+
+	sess, err := s.sessions.Get(r)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := s.ValidToken(r.Context(), sess.OpenID)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// LogoutHandler ends the current session
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if s.sessions == nil {
+		utils.WriteJSONResponse(w, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Error:   "Session mode is disabled",
+		})
+		return
+	}
+
+	if _, err := s.sessions.Get(r); errors.Is(err, session.ErrNoSession) {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Error:   "No active session",
+		})
+		return
+	}
+
+	s.sessions.Destroy(w, r)
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Logged out",
+	})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/store"
+	"tiktok-oauth2/utils"
+)
+
+// TicketRedeemHandler exchanges a ticket for the login result (X-API-Key required)
+func (s *Server) TicketRedeemHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Ticket string `json:"ticket"`
+	}
+
+	if err := utils.ReadJSONResponse(&http.Response{Body: r.Body}, &req); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+		return
+	}
+
+	if req.Ticket == "" {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Ticket is required",
+		})
+		return
+	}
+
+	authResponse, err := s.tickets.Redeem(req.Ticket)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrTicketNotFound) {
+			status = http.StatusNotFound
+		}
+		utils.WriteJSONResponse(w, status, models.APIResponse{
+			Success: false,
+			Error:   "Failed to redeem ticket: " + err.Error(),
+		})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Ticket redeemed successfully",
+		Data:    authResponse,
+	})
+}
+
+// validReturnTo reports whether a return_to URL is absolute and its origin is allowlisted
+func (s *Server) validReturnTo(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return false
+	}
+
+	// Both sides are normalized the same way, see config.ReturnToOrigins
+	origin := config.Origin(raw)
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range s.returnToOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectWithParam redirects to target with an extra query parameter
+func redirectWithParam(w http.ResponseWriter, r *http.Request, target, key, value string) {
+	u, err := url.Parse(target)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error:   "Invalid return_to URL",
+		})
+		return
+	}
+
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidReturnTo(t *testing.T) {
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.OAuth.ReturnToAllowlist = []string{"https://App.example.com", "http://localhost:3000", "https://secure.example.com:443/ignored/path"}
+	s := newTestServerWithConfig(t, cfg)
+
+	tests := []struct {
+		returnTo string
+		want     bool
+	}{
+		{"https://app.example.com/done", true},
+		{"https://APP.example.com/done?x=1", true},
+		{"HTTPS://app.example.com/done", true},
+		{"https://app.example.com:443/done", true},
+		{"https://secure.example.com/done", true},
+		{"http://localhost:3000/callback", true},
+		{"http://app.example.com/done", false},
+		{"https://app.example.com:8443/done", false},
+		{"https://app.example.com.evil.com/done", false},
+		{"https://evil.com/?https://app.example.com", false},
+		{"https://user@app.example.com/done", false},
+		{"http://localhost:3001/callback", false},
+		{"//app.example.com/done", false},
+		{"/relative", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, tt := range tests {
+		if got := s.validReturnTo(tt.returnTo); got != tt.want {
+			t.Errorf("validReturnTo(%q) = %v, want %v", tt.returnTo, got, tt.want)
+		}
+	}
+}
+
+// loginWithReturnTo runs /auth and /callback with a return_to URL and returns the ticket
+func loginWithReturnTo(t *testing.T, handler http.Handler, returnTo string) string {
+	t.Helper()
+	query := authRedirect(t, handler, "/auth?return_to="+url.QueryEscape(returnTo))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/callback?code=auth-code&state="+url.QueryEscape(query.Get("state")), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback status %d, body %s", rec.Code, rec.Body)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), returnTo) {
+		t.Fatalf("redirected to %s, want %s", location, returnTo)
+	}
+	ticket := location.Query().Get("ticket")
+	if ticket == "" {
+		t.Fatal("no ticket in the redirect")
+	}
+	return ticket
+}
+
+// redeem calls /ticket/redeem and returns the status
+func redeem(t *testing.T, handler http.Handler, ticket string) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/ticket/redeem", strings.NewReader(`{"ticket":"`+ticket+`"}`))
+	req.Header.Set("X-API-Key", "admin")
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestAuthRejectsReturnToOutsideAllowlist(t *testing.T) {
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.OAuth.ReturnToAllowlist = []string{"https://app.example.com"}
+	handler := newTestServerWithConfig(t, cfg).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth?return_to="+url.QueryEscape("https://evil.com/"), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestTicketIsSingleUse(t *testing.T) {
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.OAuth.ReturnToAllowlist = []string{"https://app.example.com"}
+	cfg.Server.AdminAPIKey = "admin"
+	handler := newTestServerWithConfig(t, cfg).Handler()
+
+	ticket := loginWithReturnTo(t, handler, "https://app.example.com/done")
+	if status := redeem(t, handler, ticket); status != http.StatusOK {
+		t.Fatalf("first redeem status %d, want 200", status)
+	}
+	if status := redeem(t, handler, ticket); status != http.StatusNotFound {
+		t.Errorf("second redeem status %d, want 404", status)
+	}
+}
+
+func TestTicketExpiresAfterTTL(t *testing.T) {
+	cfg := testConfig(newFakeTikTok(t))
+	cfg.OAuth.ReturnToAllowlist = []string{"https://app.example.com"}
+	cfg.Server.AdminAPIKey = "admin"
+	clock := &fakeClock{now: time.Now()}
+	handler := newTestServerWithConfig(t, cfg, WithClock(clock.Now)).Handler()
+
+	ticket := loginWithReturnTo(t, handler, "https://app.example.com/done")
+	clock.Advance(cfg.OAuth.TicketTTL.Duration())
+	if status := redeem(t, handler, ticket); status != http.StatusNotFound {
+		t.Errorf("redeem after TICKET_TTL status %d, want 404", status)
+	}
+}
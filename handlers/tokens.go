@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/store"
+	"tiktok-oauth2/tiktok"
+	"tiktok-oauth2/utils"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// tokenRefreshMargin is how long an access token must still be valid to be handed out as-is
+const tokenRefreshMargin = 5 * time.Minute
+
+// AccountSummary describes a stored account without exposing its tokens
+type AccountSummary struct {
+	AppID            string `json:"app_id,omitempty"`
+	OpenID           string `json:"open_id"`
+	Scope            string `json:"scope,omitempty"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
+	UpdatedAt        int64  `json:"updated_at"`
+}
+
+// ListTokensHandler lists stored accounts without their tokens
+func (s *Server) ListTokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens, err := s.tokens.List()
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error:   "Failed to list tokens: " + err.Error(),
+		})
+		return
+	}
+
+	accounts := make([]AccountSummary, 0, len(tokens))
+	for _, token := range tokens {
+		accounts = append(accounts, AccountSummary{
+			AppID:            token.AppID,
+			OpenID:           token.OpenID,
+			Scope:            token.Scope,
+			ExpiresAt:        token.ExpiresAt,
+			RefreshExpiresAt: token.RefreshExpiresAt,
+			UpdatedAt:        token.UpdatedAt,
+		})
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    accounts,
+	})
+}
+
+// GetTokenHandler returns a valid access token for an open_id, refreshing it if needed
+func (s *Server) GetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	openID := mux.Vars(r)["open_id"]
+
+	token, err := s.ValidToken(r.Context(), openID)
+	if errors.Is(err, store.ErrTokenNotFound) {
+		utils.WriteJSONResponse(w, http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Error:   "No token stored for this open_id",
+		})
+		return
+	}
+	var apiErr *tiktok.Error
+	if errors.As(err, &apiErr) {
+		writeUpstreamError(w, "Failed to refresh token", err)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Error:   "Failed to get token: " + err.Error(),
+		})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    token,
+	})
+}
+
+// DeleteTokenHandler removes the stored token for an open_id
+func (s *Server) DeleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	openID := mux.Vars(r)["open_id"]
+
+	if s.scheduler != nil {
+		s.scheduler.Forget(openID)
+	}
+
+	if err := s.tokens.Delete(openID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrTokenNotFound) {
+			status = http.StatusNotFound
+		}
+		utils.WriteJSONResponse(w, status, models.APIResponse{
+			Success: false,
+			Error:   "Failed to delete token: " + err.Error(),
+		})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Token deleted",
+	})
+}
+
+// ValidToken returns the stored token for an open_id, refreshing it first
+// when the access token expires within tokenRefreshMargin
+func (s *Server) ValidToken(ctx context.Context, openID string) (*models.TokenResponseData, error) {
+	stored, err := s.tokens.Get(openID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	if stored.AccessTokenValid(now, tokenRefreshMargin) {
+		data := stored.TokenData(now)
+		return &data, nil
+	}
+
+	s.log(ctx).Debug("🔄 Stored access token is about to expire, refreshing", "open_id", openID)
+	return s.RefreshStoredToken(ctx, *stored)
+}
+
+// RefreshStoredToken refreshes a stored token with the app it belongs to and stores the result
+func (s *Server) RefreshStoredToken(ctx context.Context, stored models.StoredToken) (*models.TokenResponseData, error) {
+	app, err := s.storedTokenApp(&stored)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenData, err := s.RefreshAccessToken(ctx, app, stored.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokens.Put(models.NewStoredToken(app.ID, *tokenData, s.now())); err != nil {
+		return nil, fmt.Errorf("failed to store refreshed token: %w", err)
+	}
+	return tokenData, nil
+}
+
+// saveToken stores an app's token by its open_id, logging failures without failing the request
+func (s *Server) saveToken(ctx context.Context, app *config.App, tokenData *models.TokenResponseData) {
+	if s.tokens == nil || tokenData.OpenID == "" {
+		return
+	}
+	if err := s.tokens.Put(models.NewStoredToken(app.ID, *tokenData, s.now())); err != nil {
+		s.log(ctx).Warn("⚠️ Failed to store token", "open_id", tokenData.OpenID, "error", err)
+	}
+}
@@ -1,40 +1,50 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"tiktok-oauth2/models"
+	"tiktok-oauth2/session"
 	"tiktok-oauth2/utils"
 )
 
 // UserInfoHandler handles user info requests
-func UserInfoHandler(w http.ResponseWriter, r *http.Request) {
-	// Get access token from Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		utils.WriteJSONResponse(w, http.StatusUnauthorized, models.APIResponse{
-			Success: false,
-			Error:   "Authorization header required",
-		})
+func (s *Server) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.requestApp(w, r)
+	if !ok {
 		return
 	}
 
-	// Extract token from "Bearer TOKEN" format
-	token := extractBearerToken(authHeader)
-	if token == "" {
-		utils.WriteJSONResponse(w, http.StatusUnauthorized, models.APIResponse{
-			Success: false,
-			Error:   "Invalid authorization format. Use 'Bearer TOKEN'",
-		})
+	// Get access token from Authorization header, or from the session cookie
+	token, ok := s.requestAccessToken(w, r)
+	if !ok {
 		return
 	}
 
-	// Fetch user info from TikTok API
-	userInfo, err := FetchUserInfo(token)
+	// Use requested fields (?fields=a,b) or all fields
+	fields := AllUserInfoFields
+	if requested := r.URL.Query().Get("fields"); requested != "" {
+		fields = strings.Split(requested, ",")
+		for i, field := range fields {
+			fields[i] = strings.TrimSpace(field)
+			if !slices.Contains(AllUserInfoFields, fields[i]) {
+				utils.WriteJSONResponse(w, http.StatusBadRequest, models.APIResponse{
+					Success: false,
+					Error:   fmt.Sprintf("Unknown user info field %q, supported fields: %s", fields[i], strings.Join(AllUserInfoFields, ",")),
+				})
+				return
+			}
+		}
+	}
+
+	// Fetch user info from TikTok API with the app the token was issued to
+	userInfo, err := s.FetchUserInfo(r.Context(), s.accessTokenApp(token, app), token, fields)
 	if err != nil {
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   "Failed to fetch user info: " + err.Error(),
-		})
+		s.onError(r, fmt.Errorf("failed to fetch user info: %w", err))
+		writeUpstreamError(w, "Failed to fetch user info", err)
 		return
 	}
 
@@ -46,6 +56,39 @@ func UserInfoHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// requestAccessToken resolves the access token from the Authorization header or the session.
+// It writes the error response and returns false when no token is available.
+func (s *Server) requestAccessToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		token, err := s.sessionAccessToken(r)
+		if err == nil {
+			return token, true
+		}
+
+		message := "Authorization header required"
+		if !errors.Is(err, session.ErrNoSession) {
+			message = "Session error: " + err.Error()
+		}
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Error:   message,
+		})
+		return "", false
+	}
+
+	// Extract token from "Bearer TOKEN" format
+	token := extractBearerToken(authHeader)
+	if token == "" {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Error:   "Invalid authorization format. Use 'Bearer TOKEN'",
+		})
+		return "", false
+	}
+	return token, true
+}
+
 // extractBearerToken extracts token from "Bearer TOKEN" format
 func extractBearerToken(authHeader string) string {
 	const bearerPrefix = "Bearer "
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/tiktok"
+)
+
+// userInfoCalls returns the number of user info calls accounted to an app
+func userInfoCalls(s *Server, appID string) int {
+	for _, usage := range s.clients[appID].Usage() {
+		if usage.Endpoint == tiktok.EndpointUserInfo {
+			return usage.Used
+		}
+	}
+	return 0
+}
+
+func TestUserInfoUsesTheRequestedApp(t *testing.T) {
+	tikTok := newFakeTikTok(t)
+	cfg := testConfig(tikTok)
+	cfg.TikTok.Apps = []config.App{{
+		ID:           "brand",
+		ClientKey:    "brand-key",
+		ClientSecret: "brand-secret",
+		RedirectURI:  "http://localhost:8080/apps/brand/callback",
+	}}
+	s := newTestServerWithConfig(t, cfg)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/apps/brand/user", nil)
+	req.Header.Set("Authorization", "Bearer act.brand")
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+
+	if got := userInfoCalls(s, "brand"); got != 1 {
+		t.Errorf("brand app made %d user info calls, want 1", got)
+	}
+	if got := userInfoCalls(s, config.DefaultAppID); got != 0 {
+		t.Errorf("default app made %d user info calls, want 0", got)
+	}
+}
+
+func TestUserInfoRejectsUnknownFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		want   int
+	}{
+		{"known fields", "open_id,%20display_name", http.StatusOK},
+		{"unknown field", "open_id,secret_field", http.StatusBadRequest},
+		{"empty entry", "open_id,", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, newFakeTikTok(t))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/user?fields="+tt.fields, nil)
+			req.Header.Set("Authorization", "Bearer act.user")
+			s.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d, body %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := userInfoCalls(s, config.DefaultAppID); tt.want != http.StatusOK && got != 0 {
+				t.Errorf("%d user info calls for a rejected request", got)
+			}
+		})
+	}
+}
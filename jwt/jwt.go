@@ -0,0 +1,277 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Claims carried in tokens issued after a TikTok login
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+
+	ClientID string `json:"client_id,omitempty"`
+	OpenID   string `json:"open_id,omitempty"`
+	UnionID  string `json:"union_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// Audience is a JWT "aud" claim, a single string or a list
+type Audience []string
+
+// MarshalJSON encodes a single audience as a plain string
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON accepts a string or a list of strings
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Contains reports whether the audience includes the given value
+func (a Audience) Contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Signer issues signed JWTs with a local RSA or ECDSA P-256 key
+type Signer struct {
+	key    crypto.Signer
+	alg    string
+	kid    string
+	issuer string
+	ttl    time.Duration
+}
+
+// NewSigner creates a signer for an *rsa.PrivateKey (RS256) or P-256 *ecdsa.PrivateKey (ES256).
+// An empty kid is derived from the public key.
+func NewSigner(key crypto.Signer, kid, issuer string, ttl time.Duration) (*Signer, error) {
+	var alg string
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key must be at least 2048 bits")
+		}
+		alg = RS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("ECDSA key must use P-256")
+		}
+		alg = ES256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	s := &Signer{key: key, alg: alg, kid: kid, issuer: issuer, ttl: ttl}
+	if s.kid == "" {
+		s.kid = s.PublicJWK().Thumbprint()
+	}
+	return s, nil
+}
+
+// GenerateSigner creates a signer with a new random ES256 key
+func GenerateSigner(issuer string, ttl time.Duration) (*Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return NewSigner(key, "", issuer, ttl)
+}
+
+// LoadSigner creates a signer from a PEM encoded private key file (PKCS#8, PKCS#1 or SEC 1)
+func LoadSigner(path, kid, issuer string, ttl time.Duration) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(key, kid, issuer, ttl)
+}
+
+// ParsePrivateKey parses a PEM encoded RSA or ECDSA private key
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
+
+// Issuer returns the issuer set on signed tokens
+func (s *Signer) Issuer() string {
+	return s.issuer
+}
+
+// Algorithm returns the signing algorithm
+func (s *Signer) Algorithm() string {
+	return s.alg
+}
+
+// TTL returns the default token lifetime
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Sign signs the claims. Issuer, issued-at and expiry are filled in when empty.
+func (s *Signer) Sign(claims Claims) (string, error) {
+	now := time.Now()
+	if claims.Issuer == "" {
+		claims.Issuer = s.issuer
+	}
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = now.Unix()
+	}
+	if claims.ExpiresAt == 0 {
+		claims.ExpiresAt = now.Add(s.ttl).Unix()
+	}
+	return s.SignPayload(claims)
+}
+
+// SignPayload signs any JSON-encodable payload without touching its claims
+func (s *Signer) SignPayload(payload interface{}) (string, error) {
+	headerJSON, err := json.Marshal(header{Alg: s.alg, Typ: "JWT", Kid: s.kid})
+	if err != nil {
+		return "", err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode claims: %w", err)
+	}
+
+	signingInput := encode(headerJSON) + "." + encode(payloadJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, sig *big.Int
+		r, sig, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		if err == nil {
+			signature = make([]byte, 64)
+			r.FillBytes(signature[:32])
+			sig.FillBytes(signature[32:])
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return signingInput + "." + encode(signature), nil
+}
+
+// PublicJWK returns the signer's public key as a JWK
+func (s *Signer) PublicJWK() JWK {
+	jwk := publicJWK(s.key.Public())
+	jwk.Kid = s.kid
+	jwk.Alg = s.alg
+	jwk.Use = "sig"
+	return jwk
+}
+
+// JWKS returns the key set to publish on /.well-known/jwks.json
+func (s *Signer) JWKS() JWKSet {
+	return JWKSet{Keys: []JWK{s.PublicJWK()}}
+}
+
+// splitToken decodes the parts of a compact JWT
+func splitToken(token string) (header, []byte, string, []byte, error) {
+	var h header
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return h, nil, "", nil, ErrMalformed
+	}
+
+	headerJSON, err := decode(parts[0])
+	if err != nil {
+		return h, nil, "", nil, ErrMalformed
+	}
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return h, nil, "", nil, ErrMalformed
+	}
+	payload, err := decode(parts[1])
+	if err != nil {
+		return h, nil, "", nil, ErrMalformed
+	}
+	signature, err := decode(parts[2])
+	if err != nil {
+		return h, nil, "", nil, ErrMalformed
+	}
+	return h, payload, parts[0] + "." + parts[1], signature, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(data)
+}
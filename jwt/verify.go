@@ -0,0 +1,154 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	// ErrMalformed is returned for tokens that are not valid compact JWTs
+	ErrMalformed = errors.New("malformed token")
+	// ErrUnknownKey is returned when the token's kid is not in the key set
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrInvalidSignature is returned when the signature does not match
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrExpired is returned for tokens past their expiry
+	ErrExpired = errors.New("token expired")
+	// ErrMissingExpiry is returned for tokens without exp, they would never expire
+	ErrMissingExpiry = errors.New("token has no expiry")
+	// ErrNotYetValid is returned for tokens used before nbf
+	ErrNotYetValid = errors.New("token not yet valid")
+	// ErrInvalidIssuer is returned when iss does not match
+	ErrInvalidIssuer = errors.New("invalid issuer")
+	// ErrInvalidAudience is returned when aud does not contain the expected audience
+	ErrInvalidAudience = errors.New("invalid audience")
+)
+
+// Verifier checks tokens issued by this service.
+// Consumers can build one from the published key set. The issuer must match
+// the service's jwt.issuer setting (default "tiktok-oauth2") and the audience
+// its jwt.audience setting (default "tiktok-oauth2-login"):
+//
+//	keys, err := jwt.FetchJWKS("https://auth.example.com/.well-known/jwks.json")
+//	verifier := jwt.NewVerifier(keys, "tiktok-oauth2").WithAudience("tiktok-oauth2-login")
+//	claims, err := verifier.Verify(token)
+type Verifier struct {
+	keys     JWKSet
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+// NewVerifier creates a verifier for a key set. An empty issuer skips the issuer check.
+func NewVerifier(keys JWKSet, issuer string) *Verifier {
+	return &Verifier{
+		keys:   keys,
+		issuer: issuer,
+		leeway: 30 * time.Second,
+		now:    time.Now,
+	}
+}
+
+// WithAudience requires tokens to carry the given audience
+func (v *Verifier) WithAudience(audience string) *Verifier {
+	v.audience = audience
+	return v
+}
+
+// WithClock sets the time source for the time claim checks
+func (v *Verifier) WithClock(now func() time.Time) *Verifier {
+	v.now = now
+	return v
+}
+
+// Verify checks the signature and time claims and returns the token's claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	var claims Claims
+	if err := v.VerifyInto(token, &claims); err != nil {
+		return nil, err
+	}
+
+	now := v.now()
+	if claims.ExpiresAt == 0 {
+		return nil, ErrMissingExpiry
+	}
+	if now.Add(-v.leeway).Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	if claims.NotBefore != 0 && now.Add(v.leeway).Unix() < claims.NotBefore {
+		return nil, ErrNotYetValid
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if v.audience != "" && !claims.Audience.Contains(v.audience) {
+		return nil, ErrInvalidAudience
+	}
+	return &claims, nil
+}
+
+// VerifyInto checks only the signature and decodes the payload into target
+func (v *Verifier) VerifyInto(token string, target interface{}) error {
+	h, payload, signingInput, signature, err := splitToken(token)
+	if err != nil {
+		return err
+	}
+
+	jwk, ok := v.keys.Key(h.Kid)
+	if !ok {
+		return ErrUnknownKey
+	}
+	if jwk.Alg != "" && jwk.Alg != h.Alg {
+		return fmt.Errorf("%w: algorithm mismatch", ErrInvalidSignature)
+	}
+	key, err := jwk.PublicKey()
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(h.Alg, key, signingInput, signature); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(payload, target); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+// verifySignature checks a RS256 or ES256 signature
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case RS256:
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key type mismatch", ErrInvalidSignature)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case ES256:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("%w: key type mismatch", ErrInvalidSignature)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidSignature, alg)
+	}
+}
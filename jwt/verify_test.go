@@ -0,0 +1,180 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "tiktok-oauth2"
+
+// newRSASigner returns an RS256 signer with a fresh key
+func newRSASigner(t *testing.T) *Signer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(key, "rsa-1", testIssuer, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// unsignedToken builds a token with the given header and an arbitrary signature
+func unsignedToken(t *testing.T, h header, claims Claims, signature []byte) string {
+	t.Helper()
+	headerJSON, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encode(headerJSON) + "." + encode(payloadJSON) + "." + encode(signature)
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	for _, alg := range []string{RS256, ES256} {
+		t.Run(alg, func(t *testing.T) {
+			signer := newRSASigner(t)
+			if alg == ES256 {
+				var err error
+				if signer, err = GenerateSigner(testIssuer, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			token, err := signer.Sign(Claims{Subject: "oid", Audience: Audience{"login"}, OpenID: "oid"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := NewVerifier(signer.JWKS(), testIssuer).WithAudience("login").Verify(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "oid" || claims.Issuer != testIssuer || claims.ExpiresAt == 0 {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsInvalidClaims(t *testing.T) {
+	signer := newRSASigner(t)
+	now := time.Unix(1_700_000_000, 0)
+	valid := Claims{
+		Issuer:    testIssuer,
+		Subject:   "oid",
+		Audience:  Audience{"login"},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Claims)
+		want   error
+	}{
+		{"expired", func(c *Claims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }, ErrExpired},
+		{"not yet valid", func(c *Claims) { c.NotBefore = now.Add(time.Hour).Unix() }, ErrNotYetValid},
+		{"wrong issuer", func(c *Claims) { c.Issuer = "https://evil.example.com" }, ErrInvalidIssuer},
+		{"wrong audience", func(c *Claims) { c.Audience = Audience{"oidc-client"} }, ErrInvalidAudience},
+		{"no audience", func(c *Claims) { c.Audience = nil }, ErrInvalidAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid
+			tt.modify(&claims)
+			token, err := signer.SignPayload(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier := NewVerifier(signer.JWKS(), testIssuer).WithAudience("login").WithClock(func() time.Time { return now })
+			if _, err := verifier.Verify(token); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMissingExpiry(t *testing.T) {
+	signer := newRSASigner(t)
+	token, err := signer.SignPayload(Claims{Issuer: testIssuer, Subject: "oid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(signer.JWKS(), testIssuer).Verify(token); !errors.Is(err, ErrMissingExpiry) {
+		t.Errorf("err = %v, want ErrMissingExpiry", err)
+	}
+}
+
+func TestVerifyRejectsAlgorithmMismatch(t *testing.T) {
+	signer := newRSASigner(t)
+	claims := Claims{Issuer: testIssuer, Subject: "oid", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	// HS256 keyed with the public key, the classic confusion attack
+	jwk := signer.PublicJWK()
+	mac := hmac.New(sha256.New, []byte(jwk.N))
+	hs256 := unsignedToken(t, header{Alg: "HS256", Typ: "JWT", Kid: "rsa-1"}, claims, nil)
+	mac.Write([]byte(hs256[:strings.LastIndex(hs256, ".")]))
+	hs256 = hs256[:strings.LastIndex(hs256, ".")+1] + encode(mac.Sum(nil))
+
+	none := unsignedToken(t, header{Alg: "none", Typ: "JWT", Kid: "rsa-1"}, claims, nil)
+
+	// Also without alg on the published key, so only the signature check stands in the way
+	noAlg := signer.JWKS()
+	for i := range noAlg.Keys {
+		noAlg.Keys[i].Alg = ""
+	}
+
+	for _, keys := range []JWKSet{signer.JWKS(), noAlg} {
+		for name, token := range map[string]string{"HS256": hs256, "none": none} {
+			if _, err := NewVerifier(keys, testIssuer).Verify(token); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("%s token with key alg %q: err = %v, want ErrInvalidSignature", name, keys.Keys[0].Alg, err)
+			}
+		}
+	}
+}
+
+func TestVerifyRejectsUnknownKey(t *testing.T) {
+	signer := newRSASigner(t)
+	other, err := GenerateSigner(testIssuer, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := other.Sign(Claims{Subject: "oid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(signer.JWKS(), testIssuer).Verify(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestVerifyRejectsTamperedPayload(t *testing.T) {
+	signer := newRSASigner(t)
+	token, err := signer.Sign(Claims{Subject: "oid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	forged, err := json.Marshal(Claims{Issuer: testIssuer, Subject: "admin", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := parts[0] + "." + encode(forged) + "." + parts[2]
+	if _, err := NewVerifier(signer.JWKS(), testIssuer).Verify(tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("err = %v, want ErrInvalidSignature", err)
+	}
+}
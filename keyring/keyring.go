@@ -0,0 +1,250 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Ciphertext prefix, values without it are treated as plaintext
+const prefix = "enc:v1:"
+
+// KeySize is the required key length (AES-256)
+const KeySize = 32
+
+var (
+	// ErrNoPrimaryKey is returned when sealing without a primary key
+	ErrNoPrimaryKey = errors.New("keyring has no primary key")
+	// ErrUnknownKey is returned when a ciphertext references a key that is not in the keyring
+	ErrUnknownKey = errors.New("unknown key id")
+	// ErrMalformed is returned for ciphertexts that cannot be parsed
+	ErrMalformed = errors.New("malformed ciphertext")
+)
+
+// Keyring holds key encryption keys by ID and seals values with AES-GCM envelope encryption.
+// Every value gets its own random data key, which is wrapped with the primary key.
+// Ciphertext format: enc:v1:<key id>:<wrapped data key>:<sealed value>
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	primary string
+}
+
+// New creates an empty keyring
+func New() *Keyring {
+	return &Keyring{keys: make(map[string][]byte)}
+}
+
+// Add adds a key to the keyring, optionally making it the primary key for new ciphertexts
+func (k *Keyring) Add(id string, key []byte, primary bool) error {
+	if id == "" || strings.Contains(id, ":") {
+		return fmt.Errorf("invalid key id %q", id)
+	}
+	if len(key) != KeySize {
+		return fmt.Errorf("key %q must be %d bytes, got %d", id, KeySize, len(key))
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[id] = append([]byte(nil), key...)
+	if primary || k.primary == "" {
+		k.primary = id
+	}
+	return nil
+}
+
+// SetPrimary selects the key used for new ciphertexts
+func (k *Keyring) SetPrimary(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	k.primary = id
+	return nil
+}
+
+// Replace swaps in the keys and primary key of other, e.g. after the key file was rotated.
+// Ciphertexts sealed with keys that are no longer in other cannot be opened afterwards.
+func (k *Keyring) Replace(other *Keyring) {
+	other.mu.RLock()
+	keys := make(map[string][]byte, len(other.keys))
+	for id, key := range other.keys {
+		keys[id] = key
+	}
+	primary := other.primary
+	other.mu.RUnlock()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.primary = primary
+}
+
+// Primary returns the ID of the primary key
+func (k *Keyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary
+}
+
+// Seal encrypts plaintext with a fresh data key wrapped by the primary key.
+// additionalData is authenticated but not encrypted and must be passed to Open again.
+func (k *Keyring) Seal(plaintext, additionalData []byte) (string, error) {
+	k.mu.RLock()
+	id, kek := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+
+	if id == "" {
+		return "", ErrNoPrimaryKey
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := seal(kek, dataKey, []byte(id))
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataKey, plaintext, additionalData)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + id + ":" +
+		base64.RawURLEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a ciphertext produced by Seal with any key in the keyring
+func (k *Keyring) Open(ciphertext string, additionalData []byte) ([]byte, error) {
+	id, wrappedKey, sealed, err := parse(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	kek, ok := k.keys[id]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	dataKey, err := open(kek, wrappedKey, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	plaintext, err := open(dataKey, sealed, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// IsSealed reports whether a value looks like a keyring ciphertext
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the ID of the key that sealed a ciphertext
+func KeyID(ciphertext string) (string, error) {
+	id, _, _, err := parse(ciphertext)
+	return id, err
+}
+
+// ParseKeys parses "id:base64key,id2:base64key" into a keyring.
+// The last key becomes primary unless primary is set.
+func ParseKeys(spec, primary string) (*Keyring, error) {
+	k := New()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key entry %q, expected id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 for key %q: %w", id, err)
+		}
+		if err := k.Add(id, key, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if primary != "" {
+		if err := k.SetPrimary(primary); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// parse splits a ciphertext into key ID, wrapped data key and sealed value
+func parse(ciphertext string) (string, []byte, []byte, error) {
+	if !IsSealed(ciphertext) {
+		return "", nil, nil, ErrMalformed
+	}
+	parts := strings.Split(strings.TrimPrefix(ciphertext, prefix), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", nil, nil, ErrMalformed
+	}
+
+	wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrappedKey, sealed, nil
+}
+
+// seal encrypts with AES-GCM and prepends the nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a nonce-prefixed AES-GCM ciphertext
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// newGCM creates an AES-GCM AEAD for a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
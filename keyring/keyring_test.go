@@ -0,0 +1,162 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	k := New()
+	if err := k.Add("k1", testKey(1), true); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := k.Seal([]byte("act.secret"), []byte("oid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "act.secret") {
+		t.Fatalf("ciphertext %q is not sealed", sealed)
+	}
+	if id, err := KeyID(sealed); err != nil || id != "k1" {
+		t.Errorf("KeyID = %q, %v, want k1", id, err)
+	}
+
+	plaintext, err := k.Open(sealed, []byte("oid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "act.secret" {
+		t.Errorf("Open = %q, want act.secret", plaintext)
+	}
+
+	again, err := k.Seal([]byte("act.secret"), []byte("oid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Error("sealing twice produced the same ciphertext")
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	k := New()
+	if err := k.Add("k1", testKey(1), true); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := k.Seal([]byte("act.secret"), []byte("oid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(sealed, prefix), ":")
+	flip := func(part string) string {
+		raw, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[len(raw)-1] ^= 0x01
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext string
+		aad        string
+	}{
+		{"tampered value", prefix + parts[0] + ":" + parts[1] + ":" + flip(parts[2]), "oid"},
+		{"tampered data key", prefix + parts[0] + ":" + flip(parts[1]) + ":" + parts[2], "oid"},
+		{"other open_id", sealed, "other"},
+		{"missing open_id", sealed, ""},
+		{"malformed", prefix + "k1:garbage", "oid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if plaintext, err := k.Open(tt.ciphertext, []byte(tt.aad)); err == nil {
+				t.Errorf("Open succeeded with %q", plaintext)
+			}
+		})
+	}
+}
+
+func TestOpenUnknownKey(t *testing.T) {
+	old := New()
+	if err := old.Add("retired", testKey(1), true); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.Seal([]byte("act.secret"), []byte("oid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := New()
+	if err := k.Add("k2", testKey(2), true); err != nil {
+		t.Fatal(err)
+	}
+	_, err = k.Open(sealed, []byte("oid"))
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want ErrUnknownKey", err)
+	}
+	if !strings.Contains(err.Error(), "retired") {
+		t.Errorf("error %q does not name the missing key", err)
+	}
+}
+
+func TestOpenWithOldKeyAfterRotation(t *testing.T) {
+	spec := "k1:" + base64.StdEncoding.EncodeToString(testKey(1))
+	k, err := ParseKeys(spec, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := k.Seal([]byte("act.secret"), []byte("oid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := ParseKeys(spec+",k2:"+base64.StdEncoding.EncodeToString(testKey(2)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rotated.Primary(); got != "k2" {
+		t.Fatalf("Primary = %q, want the last key k2", got)
+	}
+	plaintext, err := rotated.Open(sealed, []byte("oid"))
+	if err != nil || string(plaintext) != "act.secret" {
+		t.Fatalf("Open = %q, %v after rotation", plaintext, err)
+	}
+
+	resealed, err := rotated.Seal(plaintext, []byte("oid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := KeyID(resealed); id != "k2" {
+		t.Errorf("new ciphertexts use key %q, want k2", id)
+	}
+}
+
+func TestParseKeysRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		primary string
+	}{
+		{"missing id", base64.StdEncoding.EncodeToString(testKey(1)), ""},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), ""},
+		{"invalid base64", "k1:***", ""},
+		{"unknown primary", "k1:" + base64.StdEncoding.EncodeToString(testKey(1)), "k9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseKeys(tt.spec, tt.primary); err == nil {
+				t.Error("ParseKeys succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces masked values
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are always masked,
+// compared lowercased without '_' and '-'
+var sensitiveKeys = map[string]bool{
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"idtoken":       true,
+	"token":         true,
+	"clienttoken":   true,
+	"code":          true,
+	"codeverifier":  true,
+	"clientsecret":  true,
+	"secret":        true,
+	"password":      true,
+	"apikey":        true,
+	"xapikey":       true,
+	"authorization": true,
+	"cookie":        true,
+	"setcookie":     true,
+	"ticket":        true,
+}
+
+// secretPatterns find secrets inside free text such as messages, URLs,
+// form or JSON bodies and printed structs. The first group is kept.
+var secretPatterns = []*regexp.Regexp{
+	// key=value, key: value, "key":"value" and Go's %+v Key:value
+	regexp.MustCompile(`(?i)(\b(?:access_?token|refresh_?token|id_?token|client_?token|client_?secret|code_?verifier|secret|password|api_?key|ticket|token)"?\s*[:=]\s*"?)[^"&,;\s})\]]+`),
+	// Authorization codes in URLs and forms; "code" in TikTok's JSON is an error code
+	regexp.MustCompile(`(\bcode=)[^&\s"]+`),
+	// Authorization header values
+	regexp.MustCompile(`(?i)(\b(?:Bearer|Basic)\s+)[A-Za-z0-9._~+/=-]+`),
+	// TikTok access, refresh and client tokens wherever they appear
+	regexp.MustCompile(`\b((?:act|rft|clt)\.)[A-Za-z0-9._~-]+`),
+}
+
+// Redact masks tokens, codes and secrets in s
+func Redact(s string) string {
+	for _, pattern := range secretPatterns {
+		s = pattern.ReplaceAllString(s, "${1}"+Redacted)
+	}
+	return s
+}
+
+// sensitiveKey reports whether values under key are always masked
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	return sensitiveKeys[key]
+}
+
+// redactingHandler masks secrets in messages and attributes before passing
+// records on to the wrapped handler
+type redactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps next so no record reaches it unredacted
+func NewRedactingHandler(next slog.Handler) slog.Handler {
+	return redactingHandler{next: next}
+}
+
+// Enabled implements slog.Handler
+func (h redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, Redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs implements slog.Handler
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redactAttr(attr)
+	}
+	return redactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+// WithGroup implements slog.Handler
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr masks an attribute by key, or the secrets within its value
+func redactAttr(attr slog.Attr) slog.Attr {
+	attr.Value = attr.Value.Resolve()
+
+	if attr.Value.Kind() == slog.KindGroup {
+		group := attr.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, a := range group {
+			redacted[i] = redactAttr(a)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	}
+	if sensitiveKey(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(attr.Value.String()))
+	case slog.KindAny:
+		// Errors, structs and maps are logged as their redacted text
+		value := attr.Value.Any()
+		if err, ok := value.(error); ok {
+			return slog.String(attr.Key, Redact(err.Error()))
+		}
+		return slog.String(attr.Key, Redact(fmt.Sprintf("%+v", value)))
+	}
+	return attr
+}
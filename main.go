@@ -1,77 +1,109 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"tiktok-oauth2/config"
 	"tiktok-oauth2/handlers"
-	"tiktok-oauth2/models"
-	"tiktok-oauth2/utils"
+	"tiktok-oauth2/logging"
+	"time"
 
-	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
-	// Load configuration
-	config.LoadConfig()
+	configFile := flag.String("config", "", "path to a YAML or JSON config file (default: CONFIG_FILE)")
+	checkConfig := flag.Bool("check-config", false, "print the effective configuration (secrets redacted) and exit")
+	flag.Parse()
 
-	// Log debug status
-	if config.Debug {
-		log.Println("🐛 DEBUG mode enabled - detailed logging active")
-	} else {
-		log.Println("ℹ️ DEBUG mode disabled - set DEBUG=true to enable detailed logging")
+	// Load configuration
+	cfg, err := config.Load(*configFile)
+	if *checkConfig {
+		os.Exit(printConfig(cfg, err))
+	}
+	if err != nil {
+		log.Fatalf("❌ Invalid configuration:\n%v", err)
 	}
 
-	// Create router
-	router := mux.NewRouter()
-
-	// Add CORS middleware
-	router.Use(corsMiddleware)
+	// Structured logging with secrets redacted; the standard log package writes through it too
+	logOptions := cfg.Logging()
+	logger := logging.New(logOptions)
+	slog.SetDefault(logger)
+	logger.Info("📝 Logging configured", "log_level", logOptions.Level.String(), "format", cfg.Server.LogFormat)
 
-	// Health check endpoint
-	router.HandleFunc("/health", healthHandler).Methods("GET")
+	// SIGINT/SIGTERM stop the background jobs and start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// OAuth endpoints
-	router.HandleFunc("/auth", handlers.AuthHandler).Methods("GET")
-	router.HandleFunc("/callback", handlers.CallbackHandler).Methods("GET")
-	router.HandleFunc("/refresh", handlers.RefreshTokenHandler).Methods("POST")
-	router.HandleFunc("/user", handlers.UserInfoHandler).Methods("GET")
+	// Build the server from the configuration
+	server, err := handlers.New(cfg, handlers.WithLogger(logger))
+	if err != nil {
+		logger.Error("❌ Failed to set up the server", "error", err)
+		os.Exit(1)
+	}
+	defer server.Close()
+	server.Start(ctx)
 
 	// Start server
-	port := ":" + config.ServerPort
-	log.Printf("🚀 TikTok OAuth2 Server starting on port %s", config.ServerPort)
-	log.Printf("📱 Auth URL: http://localhost%s/auth", port)
-	log.Printf("🔄 Callback URL: %s", config.RedirectURI)
+	port := ":" + cfg.Server.Port
+	logger.Info("🚀 TikTok OAuth2 Server starting", "port", cfg.Server.Port)
+	logger.Info("📱 Auth URL", "url", "http://localhost"+port+"/auth")
+	apps, _, _ := cfg.Apps()
+	for _, id := range cfg.AppIDs() {
+		logger.Info("🔄 Callback URL", "app", id, "url", apps[id].RedirectURI)
+	}
 
-	if err := http.ListenAndServe(port, router); err != nil {
-		log.Fatal("❌ Server failed to start:", err)
+	httpServer := &http.Server{
+		Addr:              port,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
-}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
 
-// healthHandler provides a simple health check endpoint
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	utils.WriteJSONResponse(w, http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "TikTok OAuth2 Server is running",
-		Data: map[string]interface{}{
-			"status":  "healthy",
-			"version": "1.0.0",
-		},
-	})
-}
+	select {
+	case err := <-serveErr:
+		logger.Error("❌ Server failed to start", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
 
-// corsMiddleware adds CORS headers to responses
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	// Let in-flight requests (e.g. callbacks exchanging codes) finish
+	shutdownTimeout := cfg.Server.ShutdownTimeout.Duration()
+	logger.Info("🛑 Shutting down, waiting for in-flight requests", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("⚠️ Graceful shutdown incomplete", "error", err)
+		return
+	}
+	logger.Info("👋 Server stopped")
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// printConfig writes the redacted effective configuration and any validation errors.
+// It returns the process exit code.
+func printConfig(cfg *config.Config, err error) int {
+	out, marshalErr := yaml.Marshal(cfg.Redacted())
+	if marshalErr != nil {
+		fmt.Fprintln(os.Stderr, "❌ Failed to encode configuration:", marshalErr)
+		return 1
+	}
+	fmt.Print(string(out))
 
-		next.ServeHTTP(w, r)
-	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Invalid configuration:\n%v\n", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "✅ Configuration is valid")
+	return 0
 }
@@ -1,5 +1,9 @@
 package models
 
+import (
+	"time"
+)
+
 // TikTok OAuth2 Token Response Data
 type TokenResponseData struct {
 	AccessToken      string `json:"access_token"`
@@ -7,6 +11,50 @@ type TokenResponseData struct {
 	OpenID           string `json:"open_id"`
 	RefreshToken     string `json:"refresh_token"`
 	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	Scope            string `json:"scope,omitempty"`
+}
+
+// Token stored server-side for an account (keyed by open_id)
+type StoredToken struct {
+	AppID            string `json:"app_id,omitempty"`
+	OpenID           string `json:"open_id"`
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	Scope            string `json:"scope,omitempty"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
+	UpdatedAt        int64  `json:"updated_at"`
+}
+
+// NewStoredToken converts token response data of an app into absolute expiry times
+func NewStoredToken(appID string, data TokenResponseData, now time.Time) StoredToken {
+	return StoredToken{
+		AppID:            appID,
+		OpenID:           data.OpenID,
+		AccessToken:      data.AccessToken,
+		RefreshToken:     data.RefreshToken,
+		Scope:            data.Scope,
+		ExpiresAt:        now.Unix() + data.ExpiresIn,
+		RefreshExpiresAt: now.Unix() + data.RefreshExpiresIn,
+		UpdatedAt:        now.Unix(),
+	}
+}
+
+// TokenData converts the stored token back into response data with remaining lifetimes
+func (t StoredToken) TokenData(now time.Time) TokenResponseData {
+	return TokenResponseData{
+		AccessToken:      t.AccessToken,
+		ExpiresIn:        max(t.ExpiresAt-now.Unix(), 0),
+		OpenID:           t.OpenID,
+		RefreshToken:     t.RefreshToken,
+		RefreshExpiresIn: max(t.RefreshExpiresAt-now.Unix(), 0),
+		Scope:            t.Scope,
+	}
+}
+
+// AccessTokenValid reports whether the access token is still valid for at least the given margin
+func (t StoredToken) AccessTokenValid(now time.Time, margin time.Duration) bool {
+	return now.Add(margin).Unix() < t.ExpiresAt
 }
 
 // TikTok OAuth2 Token Response (Direct format from TikTok API)
@@ -20,17 +68,35 @@ type TokenResponse struct {
 	TokenType        string `json:"token_type"`
 }
 
-// TikTok OAuth2 Error Response
-type ErrorResponse struct {
-	Error            string `json:"error"`
-	ErrorDescription string `json:"error_description"`
-	LogID            string `json:"log_id"`
-}
-
 // Auth Request State (CSRF koruması için)
 type AuthState struct {
+	// TikTok app the flow was started for
+	App     string `json:"app,omitempty"`
 	State   string `json:"state"`
 	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+	// PKCE code verifier, empty when PKCE is not used for this flow
+	CodeVerifier string `json:"code_verifier,omitempty"`
+	// Allowlisted frontend URL to redirect to after the callback
+	ReturnTo string `json:"return_to,omitempty"`
+	// Pending OIDC authorization request when the flow was started by a relying party
+	OIDC *OIDCRequest `json:"oidc,omitempty"`
+}
+
+// OIDC authorization request from a relying party
+type OIDCRequest struct {
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state,omitempty"`
+	Nonce               string `json:"nonce,omitempty"`
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+}
+
+// Expired reports whether the state is past its expiry at the given time
+func (s AuthState) Expired(now time.Time) bool {
+	return s.Expires != 0 && now.Unix() >= s.Expires
 }
 
 // TikTok User Object (from User Info API)
@@ -73,6 +139,22 @@ type ErrorObject struct {
 type AuthResponse struct {
 	Token    TokenResponseData `json:"token"`
 	UserInfo UserInfo          `json:"user_info"`
+	JWT      string            `json:"jwt,omitempty"`
+}
+
+// Result of a token revocation
+type RevokeResult struct {
+	OpenID           string `json:"open_id,omitempty"`
+	Revoked          bool   `json:"revoked"`
+	RemovedFromStore bool   `json:"removed_from_store"`
+}
+
+// Callback response in session mode (tokens are kept server-side)
+type SessionResponse struct {
+	OpenID         string   `json:"open_id"`
+	SessionExpires int64    `json:"session_expires"`
+	UserInfo       UserInfo `json:"user_info"`
+	JWT            string   `json:"jwt,omitempty"`
 }
 
 // API Response wrapper
@@ -81,4 +163,7 @@ type APIResponse struct {
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	// ErrorCode and LogID are set for errors returned by TikTok
+	ErrorCode string `json:"error_code,omitempty"`
+	LogID     string `json:"log_id,omitempty"`
 }
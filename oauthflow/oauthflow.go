@@ -0,0 +1,141 @@
+// Package oauthflow mounts the TikTok OAuth flows on any router.
+//
+// It serves the auth, callback, refresh, revoke and user info flows as plain
+// http.Handlers under a path prefix and does not depend on a router library:
+//
+//	flow, err := oauthflow.New(cfg, oauthflow.Options{
+//		Prefix:  "/auth/tiktok",
+//		OnLogin: func(r *http.Request, event oauthflow.LoginEvent) { ... },
+//	})
+//	mux.Handle("/auth/tiktok/", flow)
+//
+// The redirect URI of the TikTok app must point to Prefix + "/callback".
+package oauthflow
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/handlers"
+)
+
+// Event types passed to the hooks
+type (
+	LoginEvent   = handlers.LoginEvent
+	RefreshEvent = handlers.RefreshEvent
+)
+
+// Options configure a mounted flow
+type Options struct {
+	// Prefix is the path the flows are mounted under, e.g. "/auth/tiktok"
+	Prefix string
+	// App is the ID of the TikTok app to use, empty for the default app
+	App string
+
+	// OnLogin is called after a successful TikTok login
+	OnLogin func(r *http.Request, event LoginEvent)
+	// OnRefresh is called after an access token was refreshed
+	OnRefresh func(event RefreshEvent)
+	// OnError is called when a flow fails
+	OnError func(r *http.Request, err error)
+}
+
+// Flow serves the OAuth flows under a path prefix
+type Flow struct {
+	server *handlers.Server
+	prefix string
+	routes map[string]route
+}
+
+// route is a flow endpoint with its allowed method
+type route struct {
+	method  string
+	handler http.Handler
+}
+
+// New creates a flow for a validated configuration.
+// Server options can inject stores, the HTTP client, clock or logger.
+func New(cfg *config.Config, opts Options, serverOpts ...handlers.Option) (*Flow, error) {
+	hooks := handlers.Hooks{
+		OnLogin:   opts.OnLogin,
+		OnRefresh: opts.OnRefresh,
+		OnError:   opts.OnError,
+	}
+	server, err := handlers.New(cfg, append(serverOpts, handlers.WithHooks(hooks))...)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Flow{
+		server: server,
+		prefix: "/" + strings.Trim(opts.Prefix, "/"),
+	}
+	if f.prefix == "/" {
+		f.prefix = ""
+	}
+
+	app := func(h http.HandlerFunc) http.Handler {
+		return server.LogRequests(handlers.WithApp(opts.App, h))
+	}
+	f.routes = map[string]route{
+		"/auth":     {http.MethodGet, app(server.RateLimit("auth", server.AuthHandler))},
+		"/callback": {http.MethodGet, app(server.RateLimit("callback", server.CallbackHandler))},
+		"/refresh":  {http.MethodPost, app(server.RateLimit("refresh", server.RefreshTokenHandler))},
+		"/revoke":   {http.MethodPost, app(server.RateLimit("revoke", server.RevokeHandler))},
+		"/user":     {http.MethodGet, app(server.RateLimit("user", server.UserInfoHandler))},
+	}
+	return f, nil
+}
+
+// Auth starts the TikTok login
+func (f *Flow) Auth() http.Handler { return f.routes["/auth"].handler }
+
+// Callback completes the TikTok login
+func (f *Flow) Callback() http.Handler { return f.routes["/callback"].handler }
+
+// Refresh refreshes an access token
+func (f *Flow) Refresh() http.Handler { return f.routes["/refresh"].handler }
+
+// Revoke revokes an account's access
+func (f *Flow) Revoke() http.Handler { return f.routes["/revoke"].handler }
+
+// UserInfo returns the TikTok user info
+func (f *Flow) UserInfo() http.Handler { return f.routes["/user"].handler }
+
+// Server returns the underlying server, e.g. for ValidToken
+func (f *Flow) Server() *handlers.Server {
+	return f.server
+}
+
+// Start runs the background jobs until the context is cancelled
+func (f *Flow) Start(ctx context.Context) {
+	f.server.Start(ctx)
+}
+
+// Close releases the resources of the flow
+func (f *Flow) Close() {
+	f.server.Close()
+}
+
+// ServeHTTP dispatches Prefix + "/auth", "/callback", "/refresh", "/revoke" and "/user"
+func (f *Flow) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, f.prefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	route, ok := f.routes[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != route.method {
+		w.Header().Set("Allow", route.method)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	route.handler.ServeHTTP(w, r)
+}
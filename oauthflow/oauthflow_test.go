@@ -0,0 +1,192 @@
+package oauthflow
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"tiktok-oauth2/config"
+	"tiktok-oauth2/handlers"
+	"tiktok-oauth2/logging"
+	"tiktok-oauth2/tiktok"
+)
+
+// newFakeTikTok serves the token and user info endpoints; the code "bad" is rejected
+func newFakeTikTok(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Authorization code is expired."})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "act.test",
+			"expires_in":    86400,
+			"open_id":       "oid",
+			"refresh_token": "rft.test",
+			"scope":         "user.info.basic",
+			"token_type":    "Bearer",
+		})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":  map[string]interface{}{"user": map[string]interface{}{"open_id": "oid", "display_name": "Test"}},
+			"error": map[string]interface{}{"code": "ok"},
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestFlow mounts a flow for one app talking to the fake TikTok API
+func newTestFlow(t *testing.T, opts Options) *Flow {
+	t.Helper()
+	tikTok := newFakeTikTok(t)
+	cfg := config.Defaults()
+	cfg.TikTok.ClientKey = "ck"
+	cfg.TikTok.ClientSecret = "secret"
+	cfg.TikTok.RedirectURI = "https://example.com/auth/tiktok/callback"
+	cfg.TikTok.TokenURL = tikTok.URL + "/token"
+	cfg.TikTok.UserInfoURL = tikTok.URL + "/user"
+	cfg.Tokens.AutoRefresh.Enabled = false
+	cfg.JWT.Enabled = false
+	cfg.RateLimit.Enabled = false
+
+	flow, err := New(cfg, opts, handlers.WithLogger(logging.Discard()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(flow.Close)
+	return flow
+}
+
+// serve sends a request to the flow
+func serve(flow *Flow, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	flow.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestServeHTTPStripsPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		mount  string
+	}{
+		{"/auth/tiktok", "/auth/tiktok"},
+		{"/auth/tiktok/", "/auth/tiktok"},
+		{"auth/tiktok", "/auth/tiktok"},
+		{"/", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			flow := newTestFlow(t, Options{Prefix: tt.prefix})
+
+			for _, request := range []struct {
+				method string
+				path   string
+				want   int
+				allow  string
+			}{
+				{http.MethodGet, tt.mount + "/auth", http.StatusFound, ""},
+				{http.MethodGet, tt.mount + "/auth/", http.StatusNotFound, ""},
+				{http.MethodGet, tt.mount + "/unknown", http.StatusNotFound, ""},
+				{http.MethodGet, tt.mount + "/", http.StatusNotFound, ""},
+				{http.MethodGet, "/other/auth", http.StatusNotFound, ""},
+				{http.MethodGet, "/auth/tiktokx/auth", http.StatusNotFound, ""},
+				{http.MethodPost, tt.mount + "/auth", http.StatusMethodNotAllowed, http.MethodGet},
+				{http.MethodGet, tt.mount + "/refresh", http.StatusMethodNotAllowed, http.MethodPost},
+				{http.MethodGet, tt.mount + "/revoke", http.StatusMethodNotAllowed, http.MethodPost},
+				{http.MethodDelete, tt.mount + "/user", http.StatusMethodNotAllowed, http.MethodGet},
+			} {
+				rec := serve(flow, request.method, request.path)
+				if rec.Code != request.want {
+					t.Errorf("%s %s: status %d, want %d", request.method, request.path, rec.Code, request.want)
+				}
+				if got := rec.Header().Get("Allow"); got != request.allow {
+					t.Errorf("%s %s: Allow = %q, want %q", request.method, request.path, got, request.allow)
+				}
+			}
+		})
+	}
+}
+
+func TestHooksFire(t *testing.T) {
+	var mu sync.Mutex
+	var logins []LoginEvent
+	var errs []error
+	flow := newTestFlow(t, Options{
+		Prefix: "/auth/tiktok/",
+		OnLogin: func(r *http.Request, event LoginEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			logins = append(logins, event)
+		},
+		OnError: func(r *http.Request, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+
+	// state returns a fresh state from the authorization redirect
+	state := func() string {
+		rec := serve(flow, http.MethodGet, "/auth/tiktok/auth")
+		location, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil || location.Query().Get("state") == "" {
+			t.Fatalf("no state in the redirect %q", rec.Header().Get("Location"))
+		}
+		return location.Query().Get("state")
+	}
+
+	if rec := serve(flow, http.MethodGet, "/auth/tiktok/callback?code=ok&state="+state()); rec.Code != http.StatusOK {
+		t.Fatalf("callback: status %d, body %s", rec.Code, rec.Body)
+	}
+	mu.Lock()
+	if len(logins) != 1 || logins[0].Token.OpenID != "oid" || logins[0].UserInfo.DisplayName != "Test" {
+		t.Errorf("OnLogin events = %+v, want one login of oid", logins)
+	}
+	if len(errs) != 0 {
+		t.Errorf("OnError called on a successful login: %v", errs)
+	}
+	mu.Unlock()
+
+	for _, failure := range []struct {
+		name string
+		path string
+		want error
+	}{
+		{"unknown state", "/auth/tiktok/callback?code=ok&state=unknown", nil},
+		{"TikTok error", "/auth/tiktok/callback?code=bad&state=" + state(), tiktok.ErrInvalidGrant},
+		{"access denied", "/auth/tiktok/callback?error=access_denied&state=" + state(), nil},
+	} {
+		mu.Lock()
+		before := len(errs)
+		mu.Unlock()
+
+		if rec := serve(flow, http.MethodGet, failure.path); rec.Code < 400 {
+			t.Errorf("%s: status %d, want an error", failure.name, rec.Code)
+		}
+		mu.Lock()
+		if len(errs) != before+1 || errs[before] == nil {
+			t.Errorf("%s: OnError called %d times, want once", failure.name, len(errs)-before)
+		} else if failure.want != nil && !errors.Is(errs[before], failure.want) {
+			t.Errorf("%s: OnError got %v, want %v", failure.name, errs[before], failure.want)
+		}
+		mu.Unlock()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logins) != 1 {
+		t.Errorf("OnLogin called %d times, want once", len(logins))
+	}
+}
@@ -0,0 +1,260 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"tiktok-oauth2/jwt"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/utils"
+)
+
+// Supported OIDC scopes
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+)
+
+// ErrCodeNotFound is returned for unknown, expired or already used authorization codes
+var ErrCodeNotFound = errors.New("invalid, expired or already used authorization code")
+
+// Client is a registered relying party
+type Client struct {
+	ID           string   `yaml:"client_id" json:"client_id"`
+	Secret       string   `yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+	Name         string   `yaml:"name,omitempty" json:"name,omitempty"`
+	RedirectURIs []string `yaml:"redirect_uris" json:"redirect_uris"`
+	// TikTok app used for the login, empty for the default app
+	App string `yaml:"app,omitempty" json:"app,omitempty"`
+}
+
+// Public reports whether the client has no secret and must use PKCE
+func (c Client) Public() bool {
+	return c.Secret == ""
+}
+
+// ValidRedirectURI reports whether uri exactly matches a registered redirect URI
+func (c Client) ValidRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if uri == registered {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate checks the client secret in constant time
+func (c Client) Authenticate(secret string) bool {
+	if c.Public() {
+		return secret == ""
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(c.Secret)) == 1
+}
+
+// ParseClients parses a JSON array of relying party clients
+func ParseClients(data string) (map[string]Client, error) {
+	var list []Client
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		return nil, fmt.Errorf("invalid OIDC clients: %w", err)
+	}
+	return ClientMap(list)
+}
+
+// ClientMap validates a list of relying party clients and indexes it by client ID
+func ClientMap(list []Client) (map[string]Client, error) {
+	clients := make(map[string]Client, len(list))
+	for _, client := range list {
+		if client.ID == "" {
+			return nil, errors.New("OIDC client without client_id")
+		}
+		if len(client.RedirectURIs) == 0 {
+			return nil, fmt.Errorf("OIDC client %s has no redirect_uris", client.ID)
+		}
+		if _, exists := clients[client.ID]; exists {
+			return nil, fmt.Errorf("duplicate OIDC client %s", client.ID)
+		}
+		clients[client.ID] = client
+	}
+	return clients, nil
+}
+
+// HasScope reports whether a space separated scope string contains scope
+func HasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TikTokScopes maps OIDC scopes to the TikTok scopes needed for their claims
+func TikTokScopes(scopes string) []string {
+	tiktokScopes := []string{"user.info.basic"}
+	if HasScope(scopes, ScopeProfile) {
+		tiktokScopes = append(tiktokScopes, "user.info.profile")
+	}
+	return tiktokScopes
+}
+
+// VerifyCodeChallenge checks a PKCE code verifier against the stored challenge.
+// S256 (utils.CodeChallengeMethodS256) is the only supported method.
+func VerifyCodeChallenge(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return true
+	}
+	if verifier == "" || method != utils.CodeChallengeMethodS256 {
+		return false
+	}
+	computed := utils.CodeChallengeS256(verifier)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// UserClaims are the standard OIDC claims derived from TikTok user info
+type UserClaims struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Profile           string `json:"profile,omitempty"`
+	UnionID           string `json:"union_id,omitempty"`
+}
+
+// ClaimsFromUserInfo maps TikTok user info to OIDC claims allowed by the granted scopes
+func ClaimsFromUserInfo(openID string, userInfo models.UserInfo, scopes string) UserClaims {
+	claims := UserClaims{Subject: openID}
+	if HasScope(scopes, ScopeProfile) {
+		claims.Name = userInfo.DisplayName
+		claims.PreferredUsername = userInfo.Username
+		claims.Picture = userInfo.AvatarURL
+		claims.Profile = userInfo.ProfileDeepLink
+		claims.UnionID = userInfo.UnionID
+	}
+	return claims
+}
+
+// IDTokenClaims is the payload of an ID token
+type IDTokenClaims struct {
+	Issuer    string       `json:"iss"`
+	Audience  jwt.Audience `json:"aud"`
+	IssuedAt  int64        `json:"iat"`
+	ExpiresAt int64        `json:"exp"`
+	AuthTime  int64        `json:"auth_time,omitempty"`
+	Nonce     string       `json:"nonce,omitempty"`
+	UserClaims
+}
+
+// Grant is the data behind an issued authorization code
+type Grant struct {
+	Request  models.OIDCRequest
+	OpenID   string
+	Scope    string
+	UserInfo models.UserInfo
+	AuthTime int64
+	expires  time.Time
+}
+
+// CodeStore keeps single-use authorization codes in memory
+type CodeStore struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	now   func() time.Time
+	codes map[string]Grant
+}
+
+// NewCodeStore creates an authorization code store with the given code lifetime
+func NewCodeStore(ttl time.Duration) *CodeStore {
+	return &CodeStore{ttl: ttl, now: time.Now, codes: make(map[string]Grant)}
+}
+
+// WithClock sets the time source for code expiry
+func (s *CodeStore) WithClock(now func() time.Time) *CodeStore {
+	s.now = now
+	return s
+}
+
+// Issue stores a grant and returns a new authorization code for it
+func (s *CodeStore) Issue(grant Grant) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+	code := base64.RawURLEncoding.EncodeToString(bytes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, g := range s.codes {
+		if !now.Before(g.expires) {
+			delete(s.codes, key)
+		}
+	}
+	grant.expires = now.Add(s.ttl)
+	s.codes[code] = grant
+	return code, nil
+}
+
+// Redeem returns the grant for a code and invalidates it
+func (s *CodeStore) Redeem(code string) (*Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, ok := s.codes[code]
+	if !ok {
+		return nil, ErrCodeNotFound
+	}
+	delete(s.codes, code)
+
+	if !s.now().Before(grant.expires) {
+		return nil, ErrCodeNotFound
+	}
+	return &grant, nil
+}
+
+// Discovery is the /.well-known/openid-configuration document
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// NewDiscovery builds the discovery document for an issuer URL
+func NewDiscovery(issuer, signingAlg string) Discovery {
+	issuer = strings.TrimRight(issuer, "/")
+	return Discovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth2/authorize",
+		TokenEndpoint:                     issuer + "/oauth2/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{signingAlg},
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		CodeChallengeMethodsSupported:     []string{utils.CodeChallengeMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "preferred_username", "picture", "profile", "union_id",
+		},
+	}
+}
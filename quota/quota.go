@@ -0,0 +1,211 @@
+// Package quota tracks outbound API calls in sliding windows and throttles
+// calls that would exceed a configured quota.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultWindow is the window usage is reported over for endpoints without a quota
+const defaultWindow = time.Minute
+
+// nearLimit is the share of a quota above which usage is reported as near the limit
+const nearLimit = 0.8
+
+// ErrExceeded is matched by errors.Is for calls rejected because of a quota
+var ErrExceeded = errors.New("quota exceeded")
+
+// ExceededError is returned when a call does not fit into the quota within the maximum wait
+type ExceededError struct {
+	Endpoint string
+	// RetryAfter is the wait until the call would fit
+	RetryAfter time.Duration
+}
+
+// Error implements error
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota of %s exceeded (retry in %s)", e.Endpoint, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrExceeded) work
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrExceeded
+}
+
+// Limit allows Requests calls in any sliding Window
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Usage is the current usage of one endpoint
+type Usage struct {
+	Endpoint string `json:"endpoint"`
+	// Used is the number of calls in the current window
+	Used int `json:"used"`
+	// Limit is the quota of the window, 0 when the endpoint is only tracked
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Window    string `json:"window"`
+	NearLimit bool   `json:"near_limit"`
+	// Throttled is the number of calls that waited for the quota, Rejected the number that gave up
+	Throttled int64 `json:"throttled"`
+	Rejected  int64 `json:"rejected"`
+}
+
+// window holds the recent calls of an endpoint
+type window struct {
+	limit     Limit
+	calls     []time.Time
+	throttled int64
+	rejected  int64
+}
+
+// prune drops calls that left the window
+func (w *window) prune(now time.Time) {
+	cutoff := now.Add(-w.limit.Window)
+	i := 0
+	for i < len(w.calls) && !w.calls[i].After(cutoff) {
+		i++
+	}
+	w.calls = w.calls[i:]
+}
+
+// Tracker accounts the calls of one app per endpoint. Endpoints without a
+// limit are only tracked. A nil Tracker allows every call.
+type Tracker struct {
+	mu      sync.Mutex
+	limits  map[string]Limit
+	maxWait time.Duration
+	now     func() time.Time
+	windows map[string]*window
+}
+
+// NewTracker creates a tracker with quotas per endpoint name. A call that does not
+// fit is queued for up to maxWait, then rejected with an ExceededError.
+func NewTracker(limits map[string]Limit, maxWait time.Duration) *Tracker {
+	return &Tracker{
+		limits:  limits,
+		maxWait: maxWait,
+		now:     time.Now,
+		windows: make(map[string]*window),
+	}
+}
+
+// Acquire records a call to an endpoint, waiting until it fits into the quota
+func (t *Tracker) Acquire(ctx context.Context, endpoint string) error {
+	if t == nil {
+		return nil
+	}
+
+	giveUp := t.now().Add(t.maxWait)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(giveUp) {
+		giveUp = deadline
+	}
+
+	throttled := false
+	for {
+		wait := t.reserve(endpoint)
+		if wait == 0 {
+			return nil
+		}
+		if t.now().Add(wait).After(giveUp) {
+			t.count(endpoint, func(w *window) { w.rejected++ })
+			return &ExceededError{Endpoint: endpoint, RetryAfter: wait}
+		}
+		if !throttled {
+			throttled = true
+			t.count(endpoint, func(w *window) { w.throttled++ })
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve records the call and returns 0 when it fits, otherwise the wait until it would
+func (t *Tracker) reserve(endpoint string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	w := t.window(endpoint)
+	w.prune(now)
+	if w.limit.Requests > 0 && len(w.calls) >= w.limit.Requests {
+		// The oldest call leaving the window frees a slot
+		return max(w.calls[0].Add(w.limit.Window).Sub(now), time.Millisecond)
+	}
+	w.calls = append(w.calls, now)
+	return 0
+}
+
+// count updates the counters of an endpoint
+func (t *Tracker) count(endpoint string, update func(*window)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	update(t.window(endpoint))
+}
+
+// window returns the window of an endpoint, creating it on first use; the caller holds the lock
+func (t *Tracker) window(endpoint string) *window {
+	w, ok := t.windows[endpoint]
+	if !ok {
+		limit := t.limits[endpoint]
+		if limit.Window <= 0 {
+			limit.Window = defaultWindow
+		}
+		w = &window{limit: limit}
+		t.windows[endpoint] = w
+	}
+	return w
+}
+
+// Usage returns the usage of every configured or called endpoint, sorted by name
+func (t *Tracker) Usage() []Usage {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for endpoint := range t.limits {
+		t.window(endpoint)
+	}
+	endpoints := make([]string, 0, len(t.windows))
+	for endpoint := range t.windows {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	now := t.now()
+	usage := make([]Usage, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		w := t.windows[endpoint]
+		w.prune(now)
+		u := Usage{
+			Endpoint:  endpoint,
+			Used:      len(w.calls),
+			Limit:     w.limit.Requests,
+			Window:    w.limit.Window.String(),
+			Throttled: w.throttled,
+			Rejected:  w.rejected,
+		}
+		if u.Limit > 0 {
+			u.Remaining = max(u.Limit-u.Used, 0)
+			u.NearLimit = float64(u.Used) >= nearLimit*float64(u.Limit)
+		}
+		usage = append(usage, u)
+	}
+	return usage
+}
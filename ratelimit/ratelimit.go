@@ -0,0 +1,143 @@
+// Package ratelimit implements token bucket rate limiting with pluggable backends.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: Requests tokens are added every Per, up to Burst tokens
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	// Burst is the bucket size, 0 uses Requests
+	Burst int
+}
+
+// capacity returns the bucket size
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate returns the refill rate in tokens per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed bool
+	// Limit is the bucket size
+	Limit int
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// RetryAfter is the wait until the next token when the request was denied
+	RetryAfter time.Duration
+	// ResetAfter is the wait until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Backend keeps the buckets. Implementations backed by a shared store
+// (e.g. Redis) let several instances enforce the same limits.
+type Backend interface {
+	// Take removes one token from the bucket of key
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is the state of one token bucket
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// MemoryBackend is an in-process Backend with a background janitor
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewMemoryBackend creates an in-memory backend and starts a janitor that
+// removes full buckets every cleanupInterval
+func NewMemoryBackend(cleanupInterval time.Duration) *MemoryBackend {
+	b := &MemoryBackend{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}
+	go b.janitor(cleanupInterval)
+	return b
+}
+
+// Take removes one token from the bucket of key
+func (b *MemoryBackend) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	capacity, rate := limit.capacity(), limit.rate()
+
+	current, ok := b.buckets[key]
+	if !ok || current.limit != limit {
+		current = &bucket{tokens: capacity, updated: now, limit: limit}
+		b.buckets[key] = current
+	}
+	current.tokens = math.Min(capacity, current.tokens+now.Sub(current.updated).Seconds()*rate)
+	current.updated = now
+
+	result := Result{Limit: int(capacity)}
+	if current.tokens >= 1 {
+		current.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - current.tokens) / rate)
+	}
+	result.Remaining = int(current.tokens)
+	result.ResetAfter = seconds((capacity - current.tokens) / rate)
+	return result, nil
+}
+
+// Close stops the janitor goroutine
+func (b *MemoryBackend) Close() {
+	b.once.Do(func() { close(b.stop) })
+}
+
+// janitor periodically removes buckets that have refilled completely
+func (b *MemoryBackend) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.removeFull(b.now())
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// removeFull deletes every bucket that is full at the given time, it would be recreated full
+func (b *MemoryBackend) removeFull(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, current := range b.buckets {
+		if current.tokens+now.Sub(current.updated).Seconds()*current.limit.rate() >= current.limit.capacity() {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+// seconds converts fractional seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
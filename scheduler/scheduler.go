@@ -0,0 +1,255 @@
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"tiktok-oauth2/logging"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/store"
+)
+
+// RefreshFunc refreshes a stored token and persists the new token data
+type RefreshFunc func(ctx context.Context, token models.StoredToken) (*models.TokenResponseData, error)
+
+// Config controls when and how tokens are refreshed
+type Config struct {
+	// Interval between scans of the token store
+	Interval time.Duration
+	// Window before access token expiry in which a token is refreshed
+	Window time.Duration
+	// Jitter is a random extra per-account advance in [0, Jitter) to spread refreshes
+	Jitter time.Duration
+	// Concurrency is the maximum number of refreshes running at once
+	Concurrency int
+	// MaxAttempts is the number of consecutive failures after which an account needs re-consent
+	MaxAttempts int
+	// Logger receives scan errors, nil disables logging
+	Logger *slog.Logger
+}
+
+// Failure records refresh failures for an account
+type Failure struct {
+	OpenID         string `json:"open_id"`
+	Attempts       int    `json:"attempts"`
+	LastError      string `json:"last_error"`
+	LastAttempt    int64  `json:"last_attempt"`
+	NeedsReconsent bool   `json:"needs_reconsent"`
+}
+
+// Scheduler refreshes stored tokens in the background before they expire
+type Scheduler struct {
+	cfg     Config
+	tokens  store.TokenStore
+	refresh RefreshFunc
+	now     func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*Failure
+	jitter   map[string]time.Duration
+}
+
+// New creates a scheduler for the accounts in a token store
+func New(tokens store.TokenStore, refresh RefreshFunc, cfg Config) *Scheduler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logging.Discard()
+	}
+
+	return &Scheduler{
+		cfg:      cfg,
+		tokens:   tokens,
+		refresh:  refresh,
+		now:      time.Now,
+		failures: make(map[string]*Failure),
+		jitter:   make(map[string]time.Duration),
+	}
+}
+
+// WithClock sets the time source for expiry and backoff decisions
+func (s *Scheduler) WithClock(now func() time.Time) *Scheduler {
+	s.now = now
+	return s
+}
+
+// Start scans the token store every Interval until the context is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	s.RunOnce(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			s.RunOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce refreshes every due account and waits for the refreshes to finish
+func (s *Scheduler) RunOnce(ctx context.Context) {
+	tokens, err := s.tokens.List()
+	if err != nil {
+		s.cfg.Logger.Error("❌ Failed to list stored tokens for refresh", "error", err)
+		return
+	}
+
+	s.forgetMissing(tokens)
+
+	now := s.now()
+	sem := make(chan struct{}, s.cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	for _, token := range tokens {
+		if !s.due(token, now) {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func(token models.StoredToken) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.refreshOne(ctx, token)
+		}(token)
+	}
+
+	wg.Wait()
+}
+
+// Failures returns the recorded failures sorted by open_id
+func (s *Scheduler) Failures() []Failure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Failure, 0, len(s.failures))
+	for _, failure := range s.failures {
+		list = append(list, *failure)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].OpenID < list[j].OpenID
+	})
+	return list
+}
+
+// Forget drops all tracking state for an account, e.g. after re-consent or revocation
+func (s *Scheduler) Forget(openID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, openID)
+	delete(s.jitter, openID)
+}
+
+// due reports whether an account should be refreshed now
+func (s *Scheduler) due(token models.StoredToken, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if failure, ok := s.failures[token.OpenID]; ok {
+		// A newer token was stored since the failure (e.g. the user logged in again)
+		if token.UpdatedAt > failure.LastAttempt {
+			delete(s.failures, token.OpenID)
+		} else if failure.NeedsReconsent {
+			return false
+		} else if now.Before(time.Unix(failure.LastAttempt, 0).Add(s.backoff(failure.Attempts))) {
+			return false
+		}
+	}
+
+	if token.RefreshToken == "" {
+		return false
+	}
+
+	jitter, ok := s.jitter[token.OpenID]
+	if !ok && s.cfg.Jitter > 0 {
+		jitter = time.Duration(rand.Int63n(int64(s.cfg.Jitter)))
+		s.jitter[token.OpenID] = jitter
+	}
+
+	return !now.Add(s.cfg.Window + jitter).Before(time.Unix(token.ExpiresAt, 0))
+}
+
+// backoff returns the wait after a number of consecutive failures, capped at one hour
+func (s *Scheduler) backoff(attempts int) time.Duration {
+	wait := s.cfg.Interval
+	for i := 1; i < attempts && wait < time.Hour; i++ {
+		wait *= 2
+	}
+	return min(wait, time.Hour)
+}
+
+// refreshOne refreshes a single account and records the outcome
+func (s *Scheduler) refreshOne(ctx context.Context, token models.StoredToken) {
+	now := s.now()
+
+	if token.RefreshExpiresAt != 0 && now.Unix() >= token.RefreshExpiresAt {
+		s.recordFailure(token.OpenID, "refresh token expired", now, true)
+		return
+	}
+
+	if _, err := s.refresh(ctx, token); err != nil {
+		s.recordFailure(token.OpenID, err.Error(), now, false)
+		return
+	}
+
+	s.Forget(token.OpenID)
+}
+
+// recordFailure increments the failure count for an account
+func (s *Scheduler) recordFailure(openID, message string, at time.Time, reconsent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failure, ok := s.failures[openID]
+	if !ok {
+		failure = &Failure{OpenID: openID}
+		s.failures[openID] = failure
+	}
+	failure.Attempts++
+	failure.LastError = message
+	failure.LastAttempt = at.Unix()
+	failure.NeedsReconsent = reconsent || failure.Attempts >= s.cfg.MaxAttempts
+}
+
+// forgetMissing drops tracking state for accounts that are no longer stored
+func (s *Scheduler) forgetMissing(tokens []models.StoredToken) {
+	present := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		present[token.OpenID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for openID := range s.failures {
+		if !present[openID] {
+			delete(s.failures, openID)
+		}
+	}
+	for openID := range s.jitter {
+		if !present[openID] {
+			delete(s.jitter, openID)
+		}
+	}
+}
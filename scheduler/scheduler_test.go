@@ -0,0 +1,313 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/store"
+)
+
+// fakeClock is a settable time source
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// recorder is a RefreshFunc that stores a token valid for a day, or fails with err
+type recorder struct {
+	tokens store.TokenStore
+	clock  *fakeClock
+	err    error
+
+	mu        sync.Mutex
+	refreshed []string
+}
+
+func (r *recorder) refresh(ctx context.Context, token models.StoredToken) (*models.TokenResponseData, error) {
+	r.mu.Lock()
+	r.refreshed = append(r.refreshed, token.OpenID)
+	err := r.err
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	data := models.TokenResponseData{OpenID: token.OpenID, AccessToken: "act.new", RefreshToken: "rft.new", ExpiresIn: 86400}
+	if err := r.tokens.Put(models.NewStoredToken(token.AppID, data, r.clock.Now())); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// calls returns the refreshed open_ids since the last call
+func (r *recorder) calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.refreshed
+	r.refreshed = nil
+	return calls
+}
+
+// newTestScheduler returns a scheduler over a memory store whose tokens expire after the given durations
+func newTestScheduler(t *testing.T, cfg Config, expiresIn map[string]time.Duration) (*Scheduler, *recorder, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	tokens := store.NewMemoryTokenStore()
+	for openID, d := range expiresIn {
+		err := tokens.Put(models.StoredToken{
+			OpenID:           openID,
+			AccessToken:      "act." + openID,
+			RefreshToken:     "rft." + openID,
+			ExpiresAt:        clock.Now().Add(d).Unix(),
+			RefreshExpiresAt: clock.Now().Add(365 * 24 * time.Hour).Unix(),
+			UpdatedAt:        clock.Now().Add(-time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := &recorder{tokens: tokens, clock: clock}
+	return New(tokens, rec.refresh, cfg).WithClock(clock.Now), rec, clock
+}
+
+func TestRunOnceRespectsWindow(t *testing.T) {
+	s, rec, clock := newTestScheduler(t, Config{Interval: time.Minute, Window: 10 * time.Minute}, map[string]time.Duration{
+		"expired": -time.Minute,
+		"soon":    5 * time.Minute,
+		"edge":    10 * time.Minute,
+		"later":   15 * time.Minute,
+		"fresh":   2 * time.Hour,
+	})
+
+	s.RunOnce(context.Background())
+	if got := sortedCalls(rec.calls()); !slices.Equal(got, []string{"edge", "expired", "soon"}) {
+		t.Errorf("refreshed %v, want edge, expired and soon", got)
+	}
+
+	// Refreshed tokens are valid for a day now, only "later" enters the window
+	clock.Advance(6 * time.Minute)
+	s.RunOnce(context.Background())
+	if got := rec.calls(); !slices.Equal(got, []string{"later"}) {
+		t.Errorf("refreshed %v after 6 minutes, want later", got)
+	}
+}
+
+func TestRunOnceAppliesJitterWithinBound(t *testing.T) {
+	s, rec, _ := newTestScheduler(t, Config{Window: 10 * time.Minute, Jitter: 5 * time.Minute}, map[string]time.Duration{
+		"inside":  10 * time.Minute,
+		"outside": 15 * time.Minute,
+	})
+
+	s.RunOnce(context.Background())
+	if got := rec.calls(); !slices.Equal(got, []string{"inside"}) {
+		t.Errorf("refreshed %v, want inside only", got)
+	}
+	s.mu.Lock()
+	jitter, ok := s.jitter["outside"]
+	s.mu.Unlock()
+	if !ok || jitter < 0 || jitter >= 5*time.Minute {
+		t.Errorf("jitter %v, want [0, 5m)", jitter)
+	}
+}
+
+func TestRunOnceSkipsTokensWithoutRefreshToken(t *testing.T) {
+	s, rec, clock := newTestScheduler(t, Config{Window: 10 * time.Minute}, nil)
+	if err := s.tokens.Put(models.StoredToken{OpenID: "norefresh", AccessToken: "act", ExpiresAt: clock.Now().Unix()}); err != nil {
+		t.Fatal(err)
+	}
+	s.RunOnce(context.Background())
+	if got := rec.calls(); len(got) != 0 {
+		t.Errorf("refreshed %v, want none", got)
+	}
+}
+
+func TestRunOnceLimitsConcurrency(t *testing.T) {
+	accounts := map[string]time.Duration{}
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		accounts[id] = time.Minute
+	}
+	s, _, _ := newTestScheduler(t, Config{Window: 10 * time.Minute, Concurrency: 3}, accounts)
+
+	var running, peak, done atomic.Int32
+	release := make(chan struct{})
+	s.refresh = func(ctx context.Context, token models.StoredToken) (*models.TokenResponseData, error) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+		done.Add(1)
+		return &models.TokenResponseData{}, nil
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		s.RunOnce(context.Background())
+		close(finished)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for running.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d refreshes started, want 3", running.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Give a fourth refresh the chance to start if the limit were broken
+	time.Sleep(20 * time.Millisecond)
+	if got := running.Load(); got != 3 {
+		t.Errorf("%d refreshes running, want 3", got)
+	}
+
+	close(release)
+	<-finished
+	if got := peak.Load(); got != 3 {
+		t.Errorf("peak concurrency %d, want 3", got)
+	}
+	if got := done.Load(); got != int32(len(accounts)) {
+		t.Errorf("%d refreshes, want %d", got, len(accounts))
+	}
+}
+
+func TestFailuresRecordedWithBackoffAndReconsent(t *testing.T) {
+	s, rec, clock := newTestScheduler(t, Config{Interval: time.Minute, Window: 10 * time.Minute, MaxAttempts: 3}, map[string]time.Duration{
+		"oid": time.Minute,
+	})
+	rec.err = errors.New("invalid_grant")
+
+	s.RunOnce(context.Background())
+	failures := s.Failures()
+	if len(failures) != 1 {
+		t.Fatalf("failures = %+v, want one", failures)
+	}
+	want := Failure{OpenID: "oid", Attempts: 1, LastError: "invalid_grant", LastAttempt: clock.Now().Unix()}
+	if failures[0] != want {
+		t.Errorf("failure = %+v, want %+v", failures[0], want)
+	}
+
+	// Within the backoff (one interval after the first failure) the account is skipped
+	rec.calls()
+	clock.Advance(30 * time.Second)
+	s.RunOnce(context.Background())
+	if got := rec.calls(); len(got) != 0 {
+		t.Errorf("refreshed %v during the backoff", got)
+	}
+
+	// Second failure after one interval, third after two more
+	clock.Advance(30 * time.Second)
+	s.RunOnce(context.Background())
+	clock.Advance(time.Minute)
+	s.RunOnce(context.Background())
+	if got := rec.calls(); len(got) != 1 {
+		t.Errorf("refreshed %d times during the doubled backoff, want 1", len(got))
+	}
+	clock.Advance(time.Minute)
+	s.RunOnce(context.Background())
+	if failures := s.Failures(); failures[0].Attempts != 3 || !failures[0].NeedsReconsent {
+		t.Fatalf("failure = %+v, want 3 attempts needing re-consent", failures[0])
+	}
+
+	// Accounts needing re-consent are not retried
+	rec.calls()
+	clock.Advance(24 * time.Hour)
+	s.RunOnce(context.Background())
+	if got := rec.calls(); len(got) != 0 {
+		t.Errorf("refreshed %v although re-consent is needed", got)
+	}
+
+	// A new login clears the failure
+	rec.err = nil
+	if err := s.tokens.Put(models.StoredToken{OpenID: "oid", RefreshToken: "rft.login", ExpiresAt: clock.Now().Unix(), UpdatedAt: clock.Now().Unix() + 1}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	s.RunOnce(context.Background())
+	if got := rec.calls(); !slices.Equal(got, []string{"oid"}) {
+		t.Errorf("refreshed %v after a new login, want oid", got)
+	}
+	if failures := s.Failures(); len(failures) != 0 {
+		t.Errorf("failures = %+v after a successful refresh, want none", failures)
+	}
+}
+
+func TestExpiredRefreshTokenNeedsReconsent(t *testing.T) {
+	s, rec, clock := newTestScheduler(t, Config{Window: 10 * time.Minute, MaxAttempts: 5}, nil)
+	if err := s.tokens.Put(models.StoredToken{OpenID: "oid", RefreshToken: "rft", ExpiresAt: clock.Now().Unix(), RefreshExpiresAt: clock.Now().Unix()}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.RunOnce(context.Background())
+	if got := rec.calls(); len(got) != 0 {
+		t.Errorf("TikTok called with an expired refresh token for %v", got)
+	}
+	failures := s.Failures()
+	if len(failures) != 1 || !failures[0].NeedsReconsent || failures[0].Attempts != 1 {
+		t.Errorf("failures = %+v, want one needing re-consent", failures)
+	}
+}
+
+func TestFailuresOfDeletedAccountsAreForgotten(t *testing.T) {
+	s, rec, _ := newTestScheduler(t, Config{Window: 10 * time.Minute}, map[string]time.Duration{"oid": time.Minute})
+	rec.err = errors.New("boom")
+	s.RunOnce(context.Background())
+	if len(s.Failures()) != 1 {
+		t.Fatal("failure not recorded")
+	}
+
+	if err := s.tokens.Delete("oid"); err != nil {
+		t.Fatal(err)
+	}
+	s.RunOnce(context.Background())
+	if failures := s.Failures(); len(failures) != 0 {
+		t.Errorf("failures = %+v after the account was deleted", failures)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := New(store.NewMemoryTokenStore(), nil, Config{Interval: time.Minute})
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := s.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// sortedCalls sorts open_ids, refreshes run concurrently
+func sortedCalls(calls []string) []string {
+	sorted := append([]string(nil), calls...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,227 @@
+package session
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoSession is returned when the request carries no session cookie
+	ErrNoSession = errors.New("no session")
+	// ErrInvalidSession is returned for tampered, unknown or expired sessions
+	ErrInvalidSession = errors.New("invalid or expired session")
+)
+
+// Session links a browser session to a stored account
+type Session struct {
+	ID      string `json:"-"`
+	OpenID  string `json:"open_id"`
+	Expires int64  `json:"expires"`
+}
+
+// Options configure the session cookie
+type Options struct {
+	CookieName string
+	TTL        time.Duration
+	Secure     bool
+	// Now is the time source for session expiry, time.Now when nil
+	Now func() time.Time
+	// Secret, when set, returns the current signing secret (e.g. re-read from a file) and
+	// replaces the one passed to NewManager when it changes. Secrets under 32 bytes are ignored.
+	Secret func() []byte
+}
+
+// Manager issues HMAC-signed session cookies and keeps sessions in memory.
+// The cookie only carries the session ID, tokens stay server-side.
+type Manager struct {
+	opts Options
+
+	secretMu sync.Mutex
+	secret   []byte
+	// previous is the secret before the last rotation, still accepted so sessions survive it
+	previous []byte
+
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewManager creates a session manager signing cookies with secret
+func NewManager(secret []byte, opts Options) (*Manager, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("session secret must be at least 32 bytes")
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = "tiktok_session"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	return &Manager{
+		secret:   secret,
+		opts:     opts,
+		sessions: make(map[string]Session),
+	}, nil
+}
+
+// Create starts a session for an account and sets the session cookie
+func (m *Manager) Create(w http.ResponseWriter, openID string) (*Session, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.opts.Now()
+	session := Session{
+		ID:      id,
+		OpenID:  openID,
+		Expires: now.Add(m.opts.TTL).Unix(),
+	}
+
+	m.mu.Lock()
+	m.pruneExpired(now)
+	m.sessions[id] = session
+	m.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.opts.CookieName,
+		Value:    id + "." + m.sign(id),
+		Path:     "/",
+		Expires:  time.Unix(session.Expires, 0),
+		MaxAge:   int(m.opts.TTL / time.Second),
+		HttpOnly: true,
+		Secure:   m.opts.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return &session, nil
+}
+
+// Get returns the session for the request's cookie after verifying its signature
+func (m *Manager) Get(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(m.opts.CookieName)
+	if err != nil {
+		return nil, ErrNoSession
+	}
+
+	id, ok := m.verify(cookie.Value)
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+	if m.opts.Now().Unix() >= session.Expires {
+		delete(m.sessions, id)
+		return nil, ErrInvalidSession
+	}
+	return &session, nil
+}
+
+// Destroy ends the request's session and clears the cookie
+func (m *Manager) Destroy(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(m.opts.CookieName); err == nil {
+		if id, ok := m.verify(cookie.Value); ok {
+			m.mu.Lock()
+			delete(m.sessions, id)
+			m.mu.Unlock()
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.opts.CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   m.opts.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// DestroyAccount ends every session of an account, e.g. after revocation
+func (m *Manager) DestroyAccount(openID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, session := range m.sessions {
+		if session.OpenID == openID {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// secrets returns the signing secret and the one it replaced, picking up a rotated secret first
+func (m *Manager) secrets() (current, previous []byte) {
+	m.secretMu.Lock()
+	defer m.secretMu.Unlock()
+
+	if m.opts.Secret != nil {
+		if secret := m.opts.Secret(); len(secret) >= 32 && !bytes.Equal(secret, m.secret) {
+			m.previous, m.secret = m.secret, secret
+		}
+	}
+	return m.secret, m.previous
+}
+
+// sign returns the base64url HMAC-SHA256 of a session ID with the current secret
+func (m *Manager) sign(id string) string {
+	current, _ := m.secrets()
+	return signWith(current, id)
+}
+
+// verify checks a cookie value against the current and previous secret and returns the session ID it carries
+func (m *Manager) verify(value string) (string, bool) {
+	id, signature, ok := strings.Cut(value, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	current, previous := m.secrets()
+	for _, secret := range [][]byte{current, previous} {
+		if secret != nil && hmac.Equal([]byte(signature), []byte(signWith(secret, id))) {
+			return id, true
+		}
+	}
+	return id, false
+}
+
+// signWith returns the base64url HMAC-SHA256 of a session ID
+func signWith(secret []byte, id string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// pruneExpired removes expired sessions, the caller must hold the lock
+func (m *Manager) pruneExpired(now time.Time) {
+	for id, session := range m.sessions {
+		if now.Unix() >= session.Expires {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// randomID generates a random session ID
+func randomID() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
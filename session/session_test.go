@@ -0,0 +1,223 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte(strings.Repeat("s", 32))
+
+// newTestManager returns a manager whose clock is read from *now
+func newTestManager(t *testing.T, secret []byte, now *time.Time) *Manager {
+	t.Helper()
+	m, err := NewManager(secret, Options{
+		TTL:    time.Hour,
+		Secure: true,
+		Now:    func() time.Time { return *now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// createCookie starts a session and returns its cookie
+func createCookie(t *testing.T, m *Manager, openID string) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	if _, err := m.Create(rec, openID); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+// requestWith returns a request carrying a cookie
+func requestWith(cookie *http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(cookie)
+	return req
+}
+
+func TestGetReturnsCreatedSession(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := newTestManager(t, testSecret, &now)
+	cookie := createCookie(t, m, "oid")
+
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie attributes %+v, want HttpOnly, Secure and SameSite=Lax", cookie)
+	}
+	session, err := m.Get(requestWith(cookie))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.OpenID != "oid" {
+		t.Errorf("OpenID = %q, want oid", session.OpenID)
+	}
+}
+
+func TestGetRejectsTamperedCookies(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := newTestManager(t, testSecret, &now)
+	cookie := createCookie(t, m, "oid")
+	other := createCookie(t, m, "other")
+
+	id, signature, _ := strings.Cut(cookie.Value, ".")
+	otherID, _, _ := strings.Cut(other.Value, ".")
+	flipped := []byte(signature)
+	flipped[0] ^= 0x01
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"changed session id", otherID + "." + signature},
+		{"changed signature", id + "." + string(flipped)},
+		{"missing signature", id},
+		{"empty signature", id + "."},
+		{"empty id", "." + signature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Get(requestWith(&http.Cookie{Name: cookie.Name, Value: tt.value}))
+			if !errors.Is(err, ErrInvalidSession) {
+				t.Errorf("err = %v, want ErrInvalidSession", err)
+			}
+		})
+	}
+}
+
+func TestGetRejectsCookieSignedWithOtherSecret(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := newTestManager(t, testSecret, &now)
+	forger := newTestManager(t, []byte(strings.Repeat("x", 32)), &now)
+
+	// The forger knows a valid session ID but not the secret
+	cookie := createCookie(t, m, "oid")
+	id, _, _ := strings.Cut(cookie.Value, ".")
+	cookie.Value = id + "." + forger.sign(id)
+
+	if _, err := m.Get(requestWith(cookie)); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("err = %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestGetRejectsAndDeletesExpiredSession(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := newTestManager(t, testSecret, &now)
+	cookie := createCookie(t, m, "oid")
+
+	now = now.Add(time.Hour)
+	if _, err := m.Get(requestWith(cookie)); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("err = %v, want ErrInvalidSession", err)
+	}
+	m.mu.Lock()
+	remaining := len(m.sessions)
+	m.mu.Unlock()
+	if remaining != 0 {
+		t.Errorf("%d sessions kept after expiry", remaining)
+	}
+
+	// Going back in time does not revive it
+	now = now.Add(-time.Hour)
+	if _, err := m.Get(requestWith(cookie)); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("err = %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestGetWithoutCookie(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := newTestManager(t, testSecret, &now)
+	if _, err := m.Get(httptest.NewRequest(http.MethodGet, "/user", nil)); !errors.Is(err, ErrNoSession) {
+		t.Errorf("err = %v, want ErrNoSession", err)
+	}
+}
+
+func TestDestroyClearsCookie(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m := newTestManager(t, testSecret, &now)
+	cookie := createCookie(t, m, "oid")
+
+	rec := httptest.NewRecorder()
+	m.Destroy(rec, requestWith(cookie))
+
+	cleared := rec.Result().Cookies()
+	if len(cleared) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cleared))
+	}
+	c := cleared[0]
+	if c.Name != cookie.Name || c.Value != "" || c.MaxAge >= 0 {
+		t.Errorf("cookie %+v does not clear the session", c)
+	}
+	if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode || c.Path != "/" {
+		t.Errorf("cookie attributes %+v, want HttpOnly, Secure, SameSite=Lax and Path=/", c)
+	}
+	if _, err := m.Get(requestWith(cookie)); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("session still valid after Destroy: %v", err)
+	}
+}
+
+func TestNewManagerRejectsShortSecret(t *testing.T) {
+	if _, err := NewManager([]byte("short"), Options{}); err == nil {
+		t.Error("NewManager accepted a short secret")
+	}
+}
+
+func TestRotatedSecretKeepsPreviousSessions(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	secret := testSecret
+	m, err := NewManager(secret, Options{
+		TTL:    time.Hour,
+		Now:    func() time.Time { return now },
+		Secret: func() []byte { return secret },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := createCookie(t, m, "before")
+
+	// The secret file changed
+	secret = []byte(strings.Repeat("r", 32))
+	after := createCookie(t, m, "after")
+	id, _, _ := strings.Cut(after.Value, ".")
+	if after.Value != id+"."+signWith(secret, id) {
+		t.Error("new cookie is not signed with the rotated secret")
+	}
+	for _, cookie := range []*http.Cookie{before, after} {
+		if _, err := m.Get(requestWith(cookie)); err != nil {
+			t.Errorf("cookie %q rejected after one rotation: %v", cookie.Value, err)
+		}
+	}
+
+	// A second rotation drops the original secret
+	secret = []byte(strings.Repeat("q", 32))
+	if _, err := m.Get(requestWith(before)); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("cookie signed two secrets ago: err = %v, want ErrInvalidSession", err)
+	}
+	if _, err := m.Get(requestWith(after)); err != nil {
+		t.Errorf("cookie signed with the previous secret rejected: %v", err)
+	}
+}
+
+func TestShortRotatedSecretIsIgnored(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	m, err := NewManager(testSecret, Options{
+		Now:    func() time.Time { return now },
+		Secret: func() []byte { return []byte("short") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := createCookie(t, m, "oid")
+	id, _, _ := strings.Cut(cookie.Value, ".")
+	if cookie.Value != id+"."+signWith(testSecret, id) {
+		t.Error("cookie not signed with the configured secret")
+	}
+}
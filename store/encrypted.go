@@ -0,0 +1,177 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"tiktok-oauth2/keyring"
+	"tiktok-oauth2/models"
+)
+
+// EncryptedTokenStore seals access and refresh tokens before they reach the underlying store.
+// Values stored before encryption was enabled are read as plaintext and sealed by Reencrypt.
+type EncryptedTokenStore struct {
+	mu    sync.Mutex
+	store TokenStore
+	keys  *keyring.Keyring
+}
+
+// NewEncryptedTokenStore wraps a token store with keyring encryption
+func NewEncryptedTokenStore(store TokenStore, keys *keyring.Keyring) *EncryptedTokenStore {
+	return &EncryptedTokenStore{store: store, keys: keys}
+}
+
+// Get returns the decrypted token for an open_id
+func (s *EncryptedTokenStore) Get(openID string) (*models.StoredToken, error) {
+	token, err := s.store.Get(openID)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(*token)
+}
+
+// Put seals the token and stores it
+func (s *EncryptedTokenStore) Put(token models.StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sealed, err := s.seal(token)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(*sealed)
+}
+
+// Delete removes the token for an open_id
+func (s *EncryptedTokenStore) Delete(openID string) error {
+	return s.store.Delete(openID)
+}
+
+// List returns all decrypted tokens
+func (s *EncryptedTokenStore) List() ([]models.StoredToken, error) {
+	tokens, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	opened := make([]models.StoredToken, 0, len(tokens))
+	for _, token := range tokens {
+		t, err := s.open(token)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, *t)
+	}
+	return opened, nil
+}
+
+// Reencrypt re-seals every token that is plaintext or sealed with a non-primary key.
+// It returns the number of tokens rewritten.
+func (s *EncryptedTokenStore) Reencrypt() (int, error) {
+	tokens, err := s.store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	primary := s.keys.Primary()
+	rewritten := 0
+	for _, token := range tokens {
+		if !s.needsReencrypt(token, primary) {
+			continue
+		}
+
+		if err := s.reencryptOne(token.OpenID, primary); err != nil {
+			return rewritten, fmt.Errorf("failed to re-encrypt token for %s: %w", token.OpenID, err)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// reencryptOne re-reads a token under the lock so concurrent writes are not overwritten
+func (s *EncryptedTokenStore) reencryptOne(openID, primary string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.store.Get(openID)
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !s.needsReencrypt(*current, primary) {
+		return nil
+	}
+
+	opened, err := s.open(*current)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.seal(*opened)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(*sealed)
+}
+
+// needsReencrypt reports whether any token field is not sealed with the primary key
+func (s *EncryptedTokenStore) needsReencrypt(token models.StoredToken, primary string) bool {
+	for _, value := range []string{token.AccessToken, token.RefreshToken} {
+		if value == "" {
+			continue
+		}
+		id, err := keyring.KeyID(value)
+		if err != nil || id != primary {
+			return true
+		}
+	}
+	return false
+}
+
+// seal encrypts the token fields, bound to the open_id
+func (s *EncryptedTokenStore) seal(token models.StoredToken) (*models.StoredToken, error) {
+	var err error
+	aad := []byte(token.OpenID)
+	if token.AccessToken, err = s.sealValue(token.AccessToken, aad); err != nil {
+		return nil, fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	if token.RefreshToken, err = s.sealValue(token.RefreshToken, aad); err != nil {
+		return nil, fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// open decrypts the token fields
+func (s *EncryptedTokenStore) open(token models.StoredToken) (*models.StoredToken, error) {
+	var err error
+	aad := []byte(token.OpenID)
+	if token.AccessToken, err = s.openValue(token.AccessToken, aad); err != nil {
+		return nil, fmt.Errorf("failed to decrypt access token: %w", err)
+	}
+	if token.RefreshToken, err = s.openValue(token.RefreshToken, aad); err != nil {
+		return nil, fmt.Errorf("failed to decrypt refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// sealValue encrypts a single value, empty values stay empty
+func (s *EncryptedTokenStore) sealValue(value string, aad []byte) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	return s.keys.Seal([]byte(value), aad)
+}
+
+// openValue decrypts a single value, plaintext values are returned as-is
+func (s *EncryptedTokenStore) openValue(value string, aad []byte) (string, error) {
+	if !keyring.IsSealed(value) {
+		return value, nil
+	}
+	plaintext, err := s.keys.Open(value, aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
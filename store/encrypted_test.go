@@ -0,0 +1,131 @@
+package store
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"tiktok-oauth2/keyring"
+	"tiktok-oauth2/models"
+)
+
+func testKeyring(t *testing.T, ids ...string) *keyring.Keyring {
+	t.Helper()
+	k := keyring.New()
+	for i, id := range ids {
+		if err := k.Add(id, bytes.Repeat([]byte{byte(i + 1)}, keyring.KeySize), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return k
+}
+
+func TestEncryptedTokenStoreSealsTokens(t *testing.T) {
+	raw := NewMemoryTokenStore()
+	s := NewEncryptedTokenStore(raw, testKeyring(t, "k1"))
+
+	if err := s.Put(models.StoredToken{OpenID: "oid", AccessToken: "act.secret", RefreshToken: "rft.secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := raw.Get("oid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored.AccessToken, "act.secret") || strings.Contains(stored.RefreshToken, "rft.secret") {
+		t.Fatalf("tokens stored in plaintext: %+v", stored)
+	}
+
+	got, err := s.Get("oid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccessToken != "act.secret" || got.RefreshToken != "rft.secret" {
+		t.Errorf("Get = %+v, want the original tokens", got)
+	}
+}
+
+func TestEncryptedTokenStoreBindsTokensToOpenID(t *testing.T) {
+	raw := NewMemoryTokenStore()
+	s := NewEncryptedTokenStore(raw, testKeyring(t, "k1"))
+	if err := s.Put(models.StoredToken{OpenID: "victim", AccessToken: "act.victim"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A sealed token copied to another account must not decrypt there
+	stolen, err := raw.Get("victim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stolen.OpenID = "attacker"
+	if err := raw.Put(*stolen); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := s.Get("attacker"); err == nil {
+		t.Errorf("Get decrypted a moved token: %+v", token)
+	}
+}
+
+func TestReencryptMovesTokensToNewPrimary(t *testing.T) {
+	raw := NewMemoryTokenStore()
+	keys := testKeyring(t, "k1")
+	s := NewEncryptedTokenStore(raw, keys)
+
+	for _, openID := range []string{"a", "b"} {
+		if err := s.Put(models.StoredToken{OpenID: openID, AccessToken: "act." + openID, RefreshToken: "rft." + openID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Written before encryption was enabled
+	if err := raw.Put(models.StoredToken{OpenID: "plain", AccessToken: "act.plain"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keys.Add("k2", bytes.Repeat([]byte{9}, keyring.KeySize), true); err != nil {
+		t.Fatal(err)
+	}
+	// Old records stay readable before re-encryption
+	if got, err := s.Get("a"); err != nil || got.AccessToken != "act.a" {
+		t.Fatalf("Get after rotation = %+v, %v", got, err)
+	}
+
+	count, err := s.Reencrypt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Reencrypt rewrote %d tokens, want 3", count)
+	}
+
+	tokens, err := raw.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range tokens {
+		for _, value := range []string{token.AccessToken, token.RefreshToken} {
+			if value == "" {
+				continue
+			}
+			if id, err := keyring.KeyID(value); err != nil || id != "k2" {
+				t.Errorf("token of %s sealed with %q (%v), want k2", token.OpenID, id, err)
+			}
+		}
+	}
+
+	// k1 can be dropped once everything is re-encrypted
+	onlyNew := keyring.New()
+	if err := onlyNew.Add("k2", bytes.Repeat([]byte{9}, keyring.KeySize), true); err != nil {
+		t.Fatal(err)
+	}
+	s = NewEncryptedTokenStore(raw, onlyNew)
+	for _, openID := range []string{"a", "b", "plain"} {
+		got, err := s.Get(openID)
+		if err != nil || got.AccessToken != "act."+openID {
+			t.Errorf("Get(%s) with only k2 = %+v, %v", openID, got, err)
+		}
+	}
+
+	if count, err := s.Reencrypt(); err != nil || count != 0 {
+		t.Errorf("second Reencrypt = %d, %v, want nothing to do", count, err)
+	}
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"sync"
+
+	"tiktok-oauth2/models"
+)
+
+// IndexedTokenStore wraps a token store with an in-memory index from access token
+// to open_id, so a token can be found by its access token without listing (and
+// decrypting) the whole store. The index holds hashes, not the tokens themselves.
+// It is built from the wrapped store on the first lookup and kept up to date by
+// Put and Delete; changes made to the wrapped store directly are not indexed.
+type IndexedTokenStore struct {
+	TokenStore
+
+	mu    sync.Mutex
+	built bool
+	// openIDs maps the hash of an access token to its open_id
+	openIDs map[string]string
+	// hashes maps an open_id to the hash of its current access token
+	hashes map[string]string
+}
+
+// NewIndexedTokenStore wraps a token store with an access token index
+func NewIndexedTokenStore(store TokenStore) *IndexedTokenStore {
+	return &IndexedTokenStore{
+		TokenStore: store,
+		openIDs:    make(map[string]string),
+		hashes:     make(map[string]string),
+	}
+}
+
+// Put stores the token and indexes its access token
+func (s *IndexedTokenStore) Put(token models.StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.TokenStore.Put(token); err != nil {
+		return err
+	}
+	s.index(token)
+	return nil
+}
+
+// Delete removes the token and its index entry
+func (s *IndexedTokenStore) Delete(openID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.TokenStore.Delete(openID); err != nil {
+		return err
+	}
+	s.unindex(openID)
+	return nil
+}
+
+// FindByAccessToken returns the stored token with this access token, or ErrTokenNotFound
+func (s *IndexedTokenStore) FindByAccessToken(accessToken string) (*models.StoredToken, error) {
+	if accessToken == "" {
+		return nil, ErrTokenNotFound
+	}
+
+	s.mu.Lock()
+	if err := s.build(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	openID, ok := s.openIDs[hashToken(accessToken)]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	token, err := s.TokenStore.Get(openID)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.AccessToken), []byte(accessToken)) != 1 {
+		return nil, ErrTokenNotFound
+	}
+	return token, nil
+}
+
+// build indexes every stored token once; the caller holds the lock
+func (s *IndexedTokenStore) build() error {
+	if s.built {
+		return nil
+	}
+	tokens, err := s.TokenStore.List()
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		s.index(token)
+	}
+	s.built = true
+	return nil
+}
+
+// index records the access token of a token; the caller holds the lock
+func (s *IndexedTokenStore) index(token models.StoredToken) {
+	s.unindex(token.OpenID)
+	if token.AccessToken == "" {
+		return
+	}
+	hash := hashToken(token.AccessToken)
+	s.openIDs[hash] = token.OpenID
+	s.hashes[token.OpenID] = hash
+}
+
+// unindex removes the index entry of an open_id; the caller holds the lock
+func (s *IndexedTokenStore) unindex(openID string) {
+	if hash, ok := s.hashes[openID]; ok {
+		delete(s.openIDs, hash)
+		delete(s.hashes, openID)
+	}
+}
+
+// hashToken returns the index key of an access token
+func hashToken(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"tiktok-oauth2/models"
+)
+
+// findOpenID returns the open_id found for an access token, or "" when none is
+func findOpenID(t *testing.T, s *IndexedTokenStore, accessToken string) string {
+	t.Helper()
+	token, err := s.FindByAccessToken(accessToken)
+	if errors.Is(err, ErrTokenNotFound) {
+		return ""
+	}
+	if err != nil {
+		t.Fatalf("FindByAccessToken(%q): %v", accessToken, err)
+	}
+	return token.OpenID
+}
+
+func TestIndexBuiltFromExistingTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	file, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []models.StoredToken{{OpenID: "a", AccessToken: "act.a"}, {OpenID: "b", AccessToken: "act.b"}} {
+		if err := file.Put(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A restart rebuilds the index from the file on the first lookup
+	reopened, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIndexedTokenStore(reopened)
+	if got := findOpenID(t, s, "act.b"); got != "b" {
+		t.Errorf("act.b found for %q, want b", got)
+	}
+	if got := findOpenID(t, s, "act.unknown"); got != "" {
+		t.Errorf("unknown access token found for %q", got)
+	}
+	if got := findOpenID(t, s, ""); got != "" {
+		t.Errorf("empty access token found for %q", got)
+	}
+}
+
+func TestIndexFollowsPutAndDelete(t *testing.T) {
+	s := NewIndexedTokenStore(NewMemoryTokenStore())
+	if err := s.Put(models.StoredToken{OpenID: "a", AccessToken: "act.old"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := findOpenID(t, s, "act.old"); got != "a" {
+		t.Fatalf("act.old found for %q, want a", got)
+	}
+
+	// A refresh replaces the access token, the old one no longer resolves
+	if err := s.Put(models.StoredToken{OpenID: "a", AccessToken: "act.new"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := findOpenID(t, s, "act.old"); got != "" {
+		t.Errorf("replaced access token still found for %q", got)
+	}
+	if got := findOpenID(t, s, "act.new"); got != "a" {
+		t.Errorf("act.new found for %q, want a", got)
+	}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := findOpenID(t, s, "act.new"); got != "" {
+		t.Errorf("deleted token still found for %q", got)
+	}
+	s.mu.Lock()
+	entries := len(s.openIDs) + len(s.hashes)
+	s.mu.Unlock()
+	if entries != 0 {
+		t.Errorf("index keeps %d entries after Delete", entries)
+	}
+}
+
+func TestIndexChecksTheStoredToken(t *testing.T) {
+	memory := NewMemoryTokenStore()
+	s := NewIndexedTokenStore(memory)
+	if err := s.Put(models.StoredToken{OpenID: "a", AccessToken: "act.old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed behind the index's back: the stale entry must not return the new token
+	if err := memory.Put(models.StoredToken{OpenID: "a", AccessToken: "act.changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := findOpenID(t, s, "act.old"); got != "" {
+		t.Errorf("stale index entry returned the token of %q", got)
+	}
+}
+
+func TestIndexSkipsFailedWrites(t *testing.T) {
+	file, err := NewFileTokenStore(filepath.Join(t.TempDir(), "missing", "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewIndexedTokenStore(file)
+	if err := s.Put(models.StoredToken{OpenID: "a", AccessToken: "act.a"}); err == nil {
+		t.Fatal("Put succeeded without a directory")
+	}
+	if got := findOpenID(t, s, "act.a"); got != "" {
+		t.Errorf("token of a failed Put found for %q", got)
+	}
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"tiktok-oauth2/models"
+)
+
+var (
+	// ErrStateNotFound is returned when a state was never issued or has already been consumed
+	ErrStateNotFound = errors.New("unknown or already used state")
+	// ErrStateExpired is returned when a state is consumed after its TTL
+	ErrStateExpired = errors.New("state expired")
+)
+
+// StateStore keeps OAuth state parameters between /auth and /callback
+type StateStore interface {
+	// Save stores a state until its expiry
+	Save(state models.AuthState) error
+	// Consume returns the stored state and removes it, so it can only be used once
+	Consume(state string) (*models.AuthState, error)
+}
+
+// MemoryStateStore is an in-memory StateStore with a background janitor
+type MemoryStateStore struct {
+	mu     sync.Mutex
+	states map[string]models.AuthState
+	now    func() time.Time
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewMemoryStateStore creates an in-memory state store and starts a janitor
+// that removes expired states every cleanupInterval
+func NewMemoryStateStore(cleanupInterval time.Duration) *MemoryStateStore {
+	s := &MemoryStateStore{
+		states: make(map[string]models.AuthState),
+		now:    time.Now,
+		stop:   make(chan struct{}),
+	}
+	go s.janitor(cleanupInterval)
+	return s
+}
+
+// WithClock sets the time source for state expiry
+func (s *MemoryStateStore) WithClock(now func() time.Time) *MemoryStateStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = now
+	return s
+}
+
+// Save stores a state until its expiry
+func (s *MemoryStateStore) Save(state models.AuthState) error {
+	if state.State == "" {
+		return errors.New("state is empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.states[state.State]; exists {
+		return errors.New("state already exists")
+	}
+	s.states[state.State] = state
+	return nil
+}
+
+// Consume returns the stored state and removes it
+func (s *MemoryStateStore) Consume(state string) (*models.AuthState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.states[state]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	delete(s.states, state)
+
+	if stored.Expired(s.now()) {
+		return nil, ErrStateExpired
+	}
+	return &stored, nil
+}
+
+// Close stops the janitor goroutine
+func (s *MemoryStateStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// janitor periodically removes expired states
+func (s *MemoryStateStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.removeExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// removeExpired deletes every state that is past its expiry
+func (s *MemoryStateStore) removeExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, state := range s.states {
+		if state.Expired(now) {
+			delete(s.states, key)
+		}
+	}
+}
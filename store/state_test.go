@@ -0,0 +1,139 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiktok-oauth2/models"
+)
+
+// newTestStateStore returns a state store whose clock is read from *now
+func newTestStateStore(t *testing.T, now *time.Time) *MemoryStateStore {
+	t.Helper()
+	s := NewMemoryStateStore(time.Hour).WithClock(func() time.Time { return *now })
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestStateIsSingleUse(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := newTestStateStore(t, &now)
+	if err := s.Save(models.AuthState{State: "st", CodeVerifier: "verifier", Expires: now.Add(10 * time.Minute).Unix()}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.Consume("st")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.CodeVerifier != "verifier" {
+		t.Errorf("CodeVerifier = %q, want verifier", stored.CodeVerifier)
+	}
+	if _, err := s.Consume("st"); !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("replayed state: err = %v, want ErrStateNotFound", err)
+	}
+	if _, err := s.Consume("never-issued"); !errors.Is(err, ErrStateNotFound) {
+		t.Errorf("unknown state: err = %v, want ErrStateNotFound", err)
+	}
+}
+
+func TestStateConsumedOnceUnderConcurrency(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := newTestStateStore(t, &now)
+	if err := s.Save(models.AuthState{State: "st", Expires: now.Add(10 * time.Minute).Unix()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var consumed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Consume("st"); err == nil {
+				consumed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := consumed.Load(); got != 1 {
+		t.Errorf("state consumed %d times, want once", got)
+	}
+}
+
+func TestStateExpiresAfterTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    error
+	}{
+		{"before expiry", 10*time.Minute - time.Second, nil},
+		{"at expiry", 10 * time.Minute, ErrStateExpired},
+		{"after expiry", time.Hour, ErrStateExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1_700_000_000, 0)
+			s := newTestStateStore(t, &now)
+			if err := s.Save(models.AuthState{State: "st", Expires: now.Add(10 * time.Minute).Unix()}); err != nil {
+				t.Fatal(err)
+			}
+
+			now = now.Add(tt.advance)
+			if _, err := s.Consume("st"); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			// Expired or not, the state is gone after the first attempt
+			if _, err := s.Consume("st"); !errors.Is(err, ErrStateNotFound) {
+				t.Errorf("second consume: err = %v, want ErrStateNotFound", err)
+			}
+		})
+	}
+}
+
+func TestRemoveExpiredKeepsValidStates(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := newTestStateStore(t, &now)
+	for i, ttl := range []time.Duration{time.Minute, 10 * time.Minute} {
+		if err := s.Save(models.AuthState{State: fmt.Sprint("st", i), Expires: now.Add(ttl).Unix()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now = now.Add(5 * time.Minute)
+	s.removeExpired()
+
+	s.mu.Lock()
+	_, short := s.states["st0"]
+	_, long := s.states["st1"]
+	s.mu.Unlock()
+	if short || !long {
+		t.Errorf("after cleanup: expired state kept %v, valid state kept %v", short, long)
+	}
+}
+
+func TestSaveRejectsEmptyAndDuplicateStates(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := newTestStateStore(t, &now)
+	if err := s.Save(models.AuthState{}); err == nil {
+		t.Error("empty state saved")
+	}
+	if err := s.Save(models.AuthState{State: "st", CodeVerifier: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(models.AuthState{State: "st", CodeVerifier: "second"}); err == nil {
+		t.Error("duplicate state saved")
+	}
+	// The duplicate did not replace the original
+	stored, err := s.Consume("st")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.CodeVerifier != "first" {
+		t.Errorf("CodeVerifier = %q, want first", stored.CodeVerifier)
+	}
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tiktok-oauth2/models"
+)
+
+// ErrTicketNotFound is returned for unknown, expired or already redeemed tickets
+var ErrTicketNotFound = errors.New("unknown, expired or already redeemed ticket")
+
+// TicketStore issues short-lived single-use tickets for login results
+type TicketStore interface {
+	// Create stores the login result and returns a new ticket for it
+	Create(data models.AuthResponse) (string, error)
+	// Redeem returns the login result and invalidates the ticket
+	Redeem(ticket string) (*models.AuthResponse, error)
+}
+
+type ticketEntry struct {
+	data    models.AuthResponse
+	expires time.Time
+}
+
+// MemoryTicketStore keeps tickets in memory
+type MemoryTicketStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	tickets map[string]ticketEntry
+}
+
+// NewMemoryTicketStore creates an in-memory ticket store with the given ticket lifetime
+func NewMemoryTicketStore(ttl time.Duration) *MemoryTicketStore {
+	return &MemoryTicketStore{
+		ttl:     ttl,
+		now:     time.Now,
+		tickets: make(map[string]ticketEntry),
+	}
+}
+
+// WithClock sets the time source for ticket expiry
+func (s *MemoryTicketStore) WithClock(now func() time.Time) *MemoryTicketStore {
+	s.now = now
+	return s
+}
+
+// Create stores the login result and returns a new ticket for it
+func (s *MemoryTicketStore) Create(data models.AuthResponse) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate ticket: %w", err)
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(bytes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, entry := range s.tickets {
+		if !now.Before(entry.expires) {
+			delete(s.tickets, key)
+		}
+	}
+	s.tickets[ticket] = ticketEntry{data: data, expires: now.Add(s.ttl)}
+	return ticket, nil
+}
+
+// Redeem returns the login result and invalidates the ticket
+func (s *MemoryTicketStore) Redeem(ticket string) (*models.AuthResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.tickets[ticket]
+	if !ok {
+		return nil, ErrTicketNotFound
+	}
+	delete(s.tickets, ticket)
+
+	if !s.now().Before(entry.expires) {
+		return nil, ErrTicketNotFound
+	}
+	return &entry.data, nil
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"tiktok-oauth2/models"
+)
+
+// ErrTokenNotFound is returned when no token is stored for an open_id
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore persists account tokens keyed by open_id
+type TokenStore interface {
+	Get(openID string) (*models.StoredToken, error)
+	Put(token models.StoredToken) error
+	Delete(openID string) error
+	List() ([]models.StoredToken, error)
+}
+
+// MemoryTokenStore keeps tokens in memory, they are lost on restart
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]models.StoredToken
+}
+
+// NewMemoryTokenStore creates an empty in-memory token store
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]models.StoredToken)}
+}
+
+// Get returns the token for an open_id
+func (s *MemoryTokenStore) Get(openID string) (*models.StoredToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.tokens[openID]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return &token, nil
+}
+
+// Put stores or replaces the token for its open_id
+func (s *MemoryTokenStore) Put(token models.StoredToken) error {
+	if token.OpenID == "" {
+		return errors.New("token has no open_id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token.OpenID] = token
+	return nil
+}
+
+// Delete removes the token for an open_id
+func (s *MemoryTokenStore) Delete(openID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[openID]; !ok {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, openID)
+	return nil
+}
+
+// List returns all stored tokens sorted by open_id
+func (s *MemoryTokenStore) List() ([]models.StoredToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedTokens(s.tokens), nil
+}
+
+// FileTokenStore keeps tokens in a JSON file, rewritten on every change
+type FileTokenStore struct {
+	mu     sync.RWMutex
+	path   string
+	tokens map[string]models.StoredToken
+}
+
+// NewFileTokenStore opens a file-backed token store, loading existing tokens if the file exists
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	s := &FileTokenStore{
+		path:   path,
+		tokens: make(map[string]models.StoredToken),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token store: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.tokens); err != nil {
+			return nil, fmt.Errorf("failed to parse token store: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Get returns the token for an open_id
+func (s *FileTokenStore) Get(openID string) (*models.StoredToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.tokens[openID]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return &token, nil
+}
+
+// Put stores or replaces the token for its open_id and persists the file
+func (s *FileTokenStore) Put(token models.StoredToken) error {
+	if token.OpenID == "" {
+		return errors.New("token has no open_id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.tokens[token.OpenID]
+	s.tokens[token.OpenID] = token
+	if err := s.save(); err != nil {
+		if existed {
+			s.tokens[token.OpenID] = previous
+		} else {
+			delete(s.tokens, token.OpenID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the token for an open_id and persists the file
+func (s *FileTokenStore) Delete(openID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.tokens[openID]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, openID)
+	if err := s.save(); err != nil {
+		s.tokens[openID] = previous
+		return err
+	}
+	return nil
+}
+
+// List returns all stored tokens sorted by open_id
+func (s *FileTokenStore) List() ([]models.StoredToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedTokens(s.tokens), nil
+}
+
+// save writes the tokens to a temp file and renames it over the store file
+func (s *FileTokenStore) save() error {
+	data, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace token store: %w", err)
+	}
+	return nil
+}
+
+// sortedTokens returns the map values sorted by open_id
+func sortedTokens(tokens map[string]models.StoredToken) []models.StoredToken {
+	list := make([]models.StoredToken, 0, len(tokens))
+	for _, token := range tokens {
+		list = append(list, token)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].OpenID < list[j].OpenID
+	})
+	return list
+}
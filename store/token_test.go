@@ -0,0 +1,141 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tiktok-oauth2/models"
+)
+
+func TestFileTokenStorePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []models.StoredToken{
+		{OpenID: "b", AccessToken: "act.b", RefreshToken: "rft.b"},
+		{OpenID: "a", AccessToken: "act.a", RefreshToken: "rft.a"},
+		{OpenID: "c", AccessToken: "act.c", RefreshToken: "rft.c"},
+	} {
+		if err := s.Put(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put(models.StoredToken{OpenID: "a", AccessToken: "act.a2", RefreshToken: "rft.a2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].OpenID != "a" || list[1].OpenID != "b" {
+		t.Fatalf("List after reopen = %+v, want a and b", list)
+	}
+	if list[0].AccessToken != "act.a2" || list[0].RefreshToken != "rft.a2" {
+		t.Errorf("token a = %+v, want the replaced token", list[0])
+	}
+	if _, err := reopened.Get("c"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("deleted token: err = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestFileTokenStoreFileIsPrivate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.json")
+	s, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(models.StoredToken{OpenID: "oid", AccessToken: "act.test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("token file mode %o, want 600", perm)
+	}
+	// The temp file was renamed, nothing else is left next to the store
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the token file", len(entries))
+	}
+}
+
+func TestFileTokenStoreRollsBackFailedWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.json")
+	s, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(models.StoredToken{OpenID: "kept", AccessToken: "act.kept"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes fail once the directory is gone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(models.StoredToken{OpenID: "new", AccessToken: "act.new"}); err == nil {
+		t.Fatal("Put succeeded without a directory")
+	}
+	if err := s.Put(models.StoredToken{OpenID: "kept", AccessToken: "act.replaced"}); err == nil {
+		t.Fatal("Put succeeded without a directory")
+	}
+	if err := s.Delete("kept"); err == nil {
+		t.Fatal("Delete succeeded without a directory")
+	}
+
+	if _, err := s.Get("new"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("failed Put kept the new token: err = %v", err)
+	}
+	kept, err := s.Get("kept")
+	if err != nil {
+		t.Fatalf("failed Delete removed the token: %v", err)
+	}
+	if kept.AccessToken != "act.kept" {
+		t.Errorf("failed Put replaced the token: %+v", kept)
+	}
+}
+
+func TestNewFileTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.json")
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(corrupt, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing.json"), empty} {
+		s, err := NewFileTokenStore(path)
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+		if list, _ := s.List(); len(list) != 0 {
+			t.Errorf("%s: %d tokens, want none", filepath.Base(path), len(list))
+		}
+	}
+	if _, err := NewFileTokenStore(corrupt); err == nil {
+		t.Error("corrupt token file accepted")
+	}
+}
@@ -0,0 +1,330 @@
+// Package tiktok is a typed client for the TikTok Login Kit and user info APIs.
+package tiktok
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tiktok-oauth2/logging"
+	"tiktok-oauth2/models"
+	"tiktok-oauth2/quota"
+	"tiktok-oauth2/utils"
+)
+
+// Default TikTok endpoints
+const (
+	DefaultAuthURL     = "https://www.tiktok.com/v2/auth/authorize/"
+	DefaultTokenURL    = "https://open.tiktokapis.com/v2/oauth/token/"
+	DefaultRevokeURL   = "https://open.tiktokapis.com/v2/oauth/revoke/"
+	DefaultUserInfoURL = "https://open.tiktokapis.com/v2/user/info/"
+)
+
+// Endpoint names used for quota accounting
+const (
+	EndpointToken    = "token"
+	EndpointRevoke   = "revoke"
+	EndpointUserInfo = "user_info"
+)
+
+// Endpoints are the TikTok URLs used by a Client. Empty fields use the defaults.
+type Endpoints struct {
+	AuthURL     string
+	TokenURL    string
+	RevokeURL   string
+	UserInfoURL string
+}
+
+// Config configures a Client
+type Config struct {
+	ClientKey string
+	// ClientSecrets returns the client secrets to try, primary first.
+	// The next secret is tried when TikTok rejects one with invalid_client.
+	ClientSecrets func() []string
+	Endpoints     Endpoints
+	// HTTPClient sends the requests, nil uses utils.NewHTTPClient
+	HTTPClient *utils.HTTPClient
+	// Logger receives debug output and warnings, e.g. when the secondary client
+	// secret was used; nil disables logging. A request-scoped logger in the
+	// call's context takes precedence.
+	Logger *slog.Logger
+	// Quota accounts and throttles the app's calls per endpoint, nil disables it
+	Quota *quota.Tracker
+	// Timeouts bound each operation including retries and quota waits
+	Timeouts Timeouts
+}
+
+// Timeouts are per-operation deadlines; zero leaves only the caller's context
+type Timeouts struct {
+	ExchangeCode time.Duration
+	Refresh      time.Duration
+	Revoke       time.Duration
+	UserInfo     time.Duration
+	ClientToken  time.Duration
+}
+
+// Client calls the TikTok API for one app
+type Client struct {
+	clientKey string
+	secrets   func() []string
+	endpoints Endpoints
+	http      *utils.HTTPClient
+	logger    *slog.Logger
+	quota     *quota.Tracker
+	timeouts  Timeouts
+}
+
+// AuthorizeParams are the parameters of the authorization URL
+type AuthorizeParams struct {
+	RedirectURI string
+	State       string
+	Scopes      []string
+	// CodeChallenge is sent with method S256 when set
+	CodeChallenge string
+}
+
+// ClientToken is an app-level access token from the client credentials grant
+type ClientToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewClient creates a client
+func NewClient(cfg Config) *Client {
+	c := &Client{
+		clientKey: cfg.ClientKey,
+		secrets:   cfg.ClientSecrets,
+		endpoints: cfg.Endpoints,
+		http:      cfg.HTTPClient,
+		logger:    cfg.Logger,
+		quota:     cfg.Quota,
+		timeouts:  cfg.Timeouts,
+	}
+	if c.secrets == nil {
+		c.secrets = func() []string { return nil }
+	}
+	if c.http == nil {
+		c.http = utils.NewHTTPClient("")
+	}
+	if c.logger == nil {
+		c.logger = logging.Discard()
+	}
+	defaultString(&c.endpoints.AuthURL, DefaultAuthURL)
+	defaultString(&c.endpoints.TokenURL, DefaultTokenURL)
+	defaultString(&c.endpoints.RevokeURL, DefaultRevokeURL)
+	defaultString(&c.endpoints.UserInfoURL, DefaultUserInfoURL)
+	return c
+}
+
+// Usage returns the app's current quota usage per endpoint
+func (c *Client) Usage() []quota.Usage {
+	return c.quota.Usage()
+}
+
+// Endpoints returns the URLs the client uses
+func (c *Client) Endpoints() Endpoints {
+	return c.endpoints
+}
+
+// AuthorizeURL builds the URL the user is redirected to for login
+func (c *Client) AuthorizeURL(params AuthorizeParams) string {
+	query := url.Values{}
+	query.Add("client_key", c.clientKey)
+	query.Add("redirect_uri", params.RedirectURI)
+	query.Add("response_type", "code")
+	query.Add("scope", strings.Join(params.Scopes, ","))
+	query.Add("state", params.State)
+	if params.CodeChallenge != "" {
+		query.Add("code_challenge", params.CodeChallenge)
+		query.Add("code_challenge_method", utils.CodeChallengeMethodS256)
+	}
+	return fmt.Sprintf("%s?%s", c.endpoints.AuthURL, query.Encode())
+}
+
+// ExchangeCode exchanges an authorization code for tokens.
+// codeVerifier is sent when the flow was started with PKCE.
+func (c *Client) ExchangeCode(ctx context.Context, code, redirectURI, codeVerifier string) (*models.TokenResponseData, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.ExchangeCode)
+	defer cancel()
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	if codeVerifier != "" {
+		form.Set("code_verifier", codeVerifier)
+	}
+	return c.token(ctx, form)
+}
+
+// Refresh exchanges a refresh token for new tokens
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*models.TokenResponseData, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Refresh)
+	defer cancel()
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return c.token(ctx, form)
+}
+
+// Revoke revokes an access token and the user's authorization of the app
+func (c *Client) Revoke(ctx context.Context, accessToken string) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Revoke)
+	defer cancel()
+
+	form := url.Values{}
+	form.Set("token", accessToken)
+	return c.postForm(utils.Idempotent(ctx), EndpointRevoke, c.endpoints.RevokeURL, form, nil)
+}
+
+// ClientToken obtains an app-level access token with the client credentials grant
+func (c *Client) ClientToken(ctx context.Context) (*ClientToken, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.ClientToken)
+	defer cancel()
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	var token ClientToken
+	if err := c.postForm(utils.Idempotent(ctx), EndpointToken, c.endpoints.TokenURL, form, &token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("no access token received")
+	}
+	return &token, nil
+}
+
+// UserInfo fetches the given user info fields with a user access token
+func (c *Client) UserInfo(ctx context.Context, accessToken string, fields ...string) (*models.UserInfo, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.UserInfo)
+	defer cancel()
+
+	userInfoURL := c.endpoints.UserInfoURL + "?fields=" + url.QueryEscape(strings.Join(fields, ","))
+	c.log(ctx).Debug("👤 Fetching user info", "url", userInfoURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var userResp models.UserInfoResponse
+	if err := c.do(EndpointUserInfo, req, &userResp); err != nil {
+		return nil, err
+	}
+	return &userResp.Data.User, nil
+}
+
+// token sends a token endpoint request and validates the result
+func (c *Client) token(ctx context.Context, form url.Values) (*models.TokenResponseData, error) {
+	var tokenResp models.TokenResponse
+	if err := c.postForm(ctx, EndpointToken, c.endpoints.TokenURL, form, &tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("no access token received")
+	}
+
+	return &models.TokenResponseData{
+		AccessToken:      tokenResp.AccessToken,
+		ExpiresIn:        tokenResp.ExpiresIn,
+		OpenID:           tokenResp.OpenID,
+		RefreshToken:     tokenResp.RefreshToken,
+		RefreshExpiresIn: tokenResp.RefreshExpiresIn,
+		Scope:            tokenResp.Scope,
+	}, nil
+}
+
+// postForm sends a form with the client credentials. When TikTok rejects a client secret
+// with invalid_client the request is retried with the next secret.
+func (c *Client) postForm(ctx context.Context, name, endpoint string, form url.Values, target interface{}) error {
+	secrets := c.secrets()
+	if len(secrets) == 0 {
+		return errors.New("no client secret configured")
+	}
+
+	var err error
+	for i, secret := range secrets {
+		form.Set("client_key", c.clientKey)
+		form.Set("client_secret", secret)
+
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		c.log(ctx).Debug("🔄 Making request", "url", endpoint)
+		err = c.do(name, req, target)
+		if !errors.Is(err, ErrInvalidClient) || i == len(secrets)-1 {
+			break
+		}
+	}
+	if err == nil && len(secrets) > 1 && form.Get("client_secret") != secrets[0] {
+		c.log(ctx).Warn("⚠️ Primary client secret was rejected, the secondary secret was accepted", "client_key", c.clientKey)
+	}
+	return err
+}
+
+// do sends a request to a named endpoint and decodes a successful response into target.
+// Every attempt, retries included, waits for and counts against the endpoint's quota.
+func (c *Client) do(name string, req *http.Request, target interface{}) error {
+	req = req.WithContext(utils.BeforeAttempt(req.Context(), func(ctx context.Context) error {
+		return c.quota.Acquire(ctx, name)
+	}))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	// The body carries tokens, the logger's redaction masks them
+	c.log(req.Context()).Debug("📄 TikTok API response", "endpoint", name, "status", resp.StatusCode, "body", string(body))
+
+	if err := parseError(resp.StatusCode, body); err != nil {
+		return err
+	}
+	if target == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// withTimeout derives a context with a timeout, or returns ctx unchanged for a zero timeout
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// defaultString sets an empty string to a default value
+func defaultString(value *string, defaultValue string) {
+	if *value == "" {
+		*value = defaultValue
+	}
+}
+
+// log returns the request-scoped logger of ctx, or the client's logger
+func (c *Client) log(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, c.logger)
+}
@@ -0,0 +1,240 @@
+package tiktok
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiktok-oauth2/quota"
+	"tiktok-oauth2/utils"
+)
+
+func TestEveryAttemptCountsAgainstQuota(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":  map[string]interface{}{"user": map[string]interface{}{"open_id": "oid"}},
+			"error": map[string]interface{}{"code": "ok"},
+		})
+	}))
+	defer server.Close()
+
+	httpClient := utils.NewHTTPClient("")
+	httpClient.Retry = utils.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	tracker := quota.NewTracker(map[string]quota.Limit{EndpointUserInfo: {Requests: 10, Window: time.Minute}}, 0)
+	client := NewClient(Config{
+		ClientKey:  "ck",
+		Endpoints:  Endpoints{UserInfoURL: server.URL},
+		HTTPClient: httpClient,
+		Quota:      tracker,
+	})
+
+	if _, err := client.UserInfo(context.Background(), "act.test", "open_id"); err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("TikTok received %d requests, want 3", got)
+	}
+	usage := tracker.Usage()
+	if len(usage) != 1 || usage[0].Used != 3 {
+		t.Errorf("quota usage = %+v, want 3 calls to %s", usage, EndpointUserInfo)
+	}
+}
+
+func TestQuotaRejectsRetryWithoutSending(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	httpClient := utils.NewHTTPClient("")
+	httpClient.Retry = utils.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	client := NewClient(Config{
+		ClientKey:  "ck",
+		Endpoints:  Endpoints{UserInfoURL: server.URL},
+		HTTPClient: httpClient,
+		Quota:      quota.NewTracker(map[string]quota.Limit{EndpointUserInfo: {Requests: 1, Window: time.Minute}}, 0),
+	})
+
+	_, err := client.UserInfo(context.Background(), "act.test", "open_id")
+	if err == nil {
+		t.Fatal("UserInfo succeeded, want quota error")
+	}
+	if !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("err = %v, want quota exceeded", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("TikTok received %d requests, want 1", got)
+	}
+}
+
+func TestBreakerRejectionUsesNoQuota(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	httpClient := utils.NewHTTPClient("")
+	httpClient.Retry = utils.RetryPolicy{MaxAttempts: 1}
+	httpClient.Breaker = utils.BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Minute}
+	tracker := quota.NewTracker(map[string]quota.Limit{EndpointUserInfo: {Requests: 10, Window: time.Minute}}, 0)
+	client := NewClient(Config{
+		ClientKey:  "ck",
+		Endpoints:  Endpoints{UserInfoURL: server.URL},
+		HTTPClient: httpClient,
+		Quota:      tracker,
+	})
+
+	if _, err := client.UserInfo(context.Background(), "act.test", "open_id"); err == nil {
+		t.Fatal("UserInfo succeeded against a failing endpoint")
+	}
+	_, err := client.UserInfo(context.Background(), "act.test", "open_id")
+	if !errors.Is(err, utils.ErrCircuitOpen) {
+		t.Fatalf("err = %v, want circuit open", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("TikTok received %d requests, want 1", got)
+	}
+	usage := tracker.Usage()
+	if len(usage) != 1 || usage[0].Used != 1 {
+		t.Errorf("quota usage = %+v, want only the sent call counted", usage)
+	}
+}
+
+func TestTokenGrantsAreNotRetriedOnServerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(c *Client) error
+		want int32
+	}{
+		{"code exchange", func(c *Client) error {
+			_, err := c.ExchangeCode(context.Background(), "code", "https://example.com/callback", "")
+			return err
+		}, 1},
+		{"refresh", func(c *Client) error {
+			_, err := c.Refresh(context.Background(), "rft.test")
+			return err
+		}, 1},
+		{"client credentials", func(c *Client) error {
+			_, err := c.ClientToken(context.Background())
+			return err
+		}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			httpClient := utils.NewHTTPClient("")
+			httpClient.Retry = utils.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+			client := NewClient(Config{
+				ClientKey:     "ck",
+				ClientSecrets: func() []string { return []string{"secret"} },
+				Endpoints:     Endpoints{TokenURL: server.URL},
+				HTTPClient:    httpClient,
+			})
+
+			if err := tt.call(client); err == nil {
+				t.Fatal("call succeeded against a failing endpoint")
+			}
+			if got := calls.Load(); got != tt.want {
+				t.Errorf("TikTok received %d requests, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecondarySecretTriedOnInvalidClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		accepted    string
+		wantErr     error
+		wantSecrets []string
+	}{
+		{"secondary accepted", "secondary", nil, []string{"primary", "secondary"}},
+		{"primary accepted", "primary", nil, []string{"primary"}},
+		{"both rejected", "", ErrInvalidClient, []string{"primary", "secondary"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var tried []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				secret := r.PostForm.Get("client_secret")
+				mu.Lock()
+				tried = append(tried, secret)
+				mu.Unlock()
+
+				if secret != tt.accepted {
+					w.WriteHeader(http.StatusUnauthorized)
+					json.NewEncoder(w).Encode(map[string]string{"error": CodeInvalidClient, "error_description": "Client key or secret is incorrect."})
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "act.test", "expires_in": 86400, "open_id": "oid"})
+			}))
+			defer server.Close()
+
+			client := NewClient(Config{
+				ClientKey:     "ck",
+				ClientSecrets: func() []string { return []string{"primary", "secondary"} },
+				Endpoints:     Endpoints{TokenURL: server.URL},
+				HTTPClient:    utils.NewHTTPClient(""),
+			})
+
+			token, err := client.ExchangeCode(context.Background(), "code", "https://example.com/callback", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && token.AccessToken != "act.test" {
+				t.Errorf("access token = %q, want act.test", token.AccessToken)
+			}
+			if !slices.Equal(tried, tt.wantSecrets) {
+				t.Errorf("secrets tried = %v, want %v", tried, tt.wantSecrets)
+			}
+		})
+	}
+}
+
+func TestSecondarySecretNotTriedOnOtherErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": CodeInvalidGrant, "error_description": "Authorization code is expired."})
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		ClientKey:     "ck",
+		ClientSecrets: func() []string { return []string{"primary", "secondary"} },
+		Endpoints:     Endpoints{TokenURL: server.URL},
+		HTTPClient:    utils.NewHTTPClient(""),
+	})
+
+	if _, err := client.ExchangeCode(context.Background(), "code", "https://example.com/callback", ""); !errors.Is(err, ErrInvalidGrant) {
+		t.Fatalf("err = %v, want invalid_grant", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("TikTok received %d requests, want 1", got)
+	}
+}
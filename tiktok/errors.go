@@ -0,0 +1,170 @@
+package tiktok
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Error is an error returned by the TikTok API, from either an OAuth error body
+// ({"error":"invalid_grant","error_description":...}) or the API error envelope
+// ({"error":{"code":...,"message":...,"log_id":...}})
+type Error struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Code is the TikTok error code, e.g. invalid_grant or access_token_invalid
+	Code    string
+	Message string
+	// LogID identifies the request in TikTok's logs
+	LogID string
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	msg := e.Code
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.LogID != "" {
+		msg += " (log_id: " + e.LogID + ")"
+	}
+	return msg
+}
+
+// Is matches errors with the same code, so errors.Is(err, tiktok.ErrInvalidClient) works
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// TikTok error codes of the OAuth endpoints and the API envelope
+const (
+	CodeInvalidRequest         = "invalid_request"
+	CodeInvalidClient          = "invalid_client"
+	CodeInvalidGrant           = "invalid_grant"
+	CodeInvalidScope           = "invalid_scope"
+	CodeUnauthorizedClient     = "unauthorized_client"
+	CodeUnsupportedGrantType   = "unsupported_grant_type"
+	CodeAccessDenied           = "access_denied"
+	CodeServerError            = "server_error"
+	CodeTemporarilyUnavailable = "temporarily_unavailable"
+
+	CodeAccessTokenInvalid    = "access_token_invalid"
+	CodeInvalidParams         = "invalid_params"
+	CodeScopeNotAuthorized    = "scope_not_authorized"
+	CodeScopePermissionMissed = "scope_permission_missed"
+	CodeRateLimitExceeded     = "rate_limit_exceeded"
+	CodeInternalError         = "internal_error"
+
+	// CodeHTTPError is used for error responses without a TikTok error body
+	CodeHTTPError = "http_error"
+)
+
+// Errors to match with errors.Is
+var (
+	// ErrInvalidClient is returned when TikTok rejects the client key or secret
+	ErrInvalidClient = &Error{Code: CodeInvalidClient}
+	// ErrInvalidGrant is returned for invalid, expired or already used codes and refresh tokens
+	ErrInvalidGrant = &Error{Code: CodeInvalidGrant}
+	// ErrAccessTokenInvalid is returned for invalid or expired access tokens
+	ErrAccessTokenInvalid = &Error{Code: CodeAccessTokenInvalid}
+	// ErrScopeNotAuthorized is returned when the user did not grant a required scope
+	ErrScopeNotAuthorized = &Error{Code: CodeScopeNotAuthorized}
+	// ErrRateLimitExceeded is returned when the app exceeded a TikTok rate limit
+	ErrRateLimitExceeded = &Error{Code: CodeRateLimitExceeded}
+)
+
+// Kind classifies TikTok errors by who has to act on them
+type Kind int
+
+const (
+	// KindUpstream is a TikTok-side or configuration failure the caller cannot fix
+	KindUpstream Kind = iota
+	// KindBadRequest is a rejected request parameter, code or refresh token
+	KindBadRequest
+	// KindUnauthorized is an invalid or expired access token
+	KindUnauthorized
+	// KindForbidden is a missing scope or denied authorization
+	KindForbidden
+	// KindRateLimited is an exceeded TikTok rate limit
+	KindRateLimited
+)
+
+// Kind returns the class of the error
+func (e *Error) Kind() Kind {
+	switch e.Code {
+	case CodeInvalidRequest, CodeInvalidGrant, CodeInvalidScope, CodeUnsupportedGrantType, CodeInvalidParams:
+		return KindBadRequest
+	case CodeAccessTokenInvalid:
+		return KindUnauthorized
+	case CodeScopeNotAuthorized, CodeScopePermissionMissed, CodeAccessDenied:
+		return KindForbidden
+	case CodeRateLimitExceeded:
+		return KindRateLimited
+	case CodeInvalidClient, CodeUnauthorizedClient:
+		// Our credentials were rejected, whatever the HTTP status says
+		return KindUpstream
+	}
+
+	// Fall back to the HTTP status for codes we do not know
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return KindUnauthorized
+	case http.StatusForbidden:
+		return KindForbidden
+	case http.StatusTooManyRequests:
+		return KindRateLimited
+	}
+	return KindUpstream
+}
+
+// errorBody matches both TikTok error formats
+type errorBody struct {
+	Error            json.RawMessage `json:"error"`
+	ErrorDescription string          `json:"error_description"`
+	LogID            string          `json:"log_id"`
+}
+
+// envelopeError is the error object of the API envelope
+type envelopeError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	LogID   string `json:"log_id"`
+}
+
+// parseError returns the error in a TikTok response body, or nil when the call succeeded
+func parseError(statusCode int, body []byte) error {
+	if len(body) == 0 && statusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	var parsed errorBody
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		if statusCode >= http.StatusBadRequest {
+			return &Error{StatusCode: statusCode, Code: CodeHTTPError, Message: http.StatusText(statusCode)}
+		}
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	var apiErr *Error
+	if len(parsed.Error) > 0 && parsed.Error[0] == '{' {
+		var envelope envelopeError
+		if err := json.Unmarshal(parsed.Error, &envelope); err == nil && envelope.Code != "" && envelope.Code != "ok" {
+			apiErr = &Error{Code: envelope.Code, Message: envelope.Message, LogID: envelope.LogID}
+		}
+	} else if len(parsed.Error) > 0 {
+		var code string
+		if err := json.Unmarshal(parsed.Error, &code); err == nil && code != "" {
+			apiErr = &Error{Code: code, Message: parsed.ErrorDescription, LogID: parsed.LogID}
+		}
+	}
+
+	if apiErr == nil && statusCode >= http.StatusBadRequest {
+		apiErr = &Error{Code: CodeHTTPError, Message: http.StatusText(statusCode)}
+	}
+	if apiErr == nil {
+		return nil
+	}
+	apiErr.StatusCode = statusCode
+	return apiErr
+}
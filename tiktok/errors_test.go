@@ -0,0 +1,112 @@
+package tiktok
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantCode string
+		wantMsg  string
+		wantLog  string
+	}{
+		{
+			name:     "OAuth error body",
+			status:   http.StatusBadRequest,
+			body:     `{"error":"invalid_grant","error_description":"Authorization code is expired.","log_id":"202401"}`,
+			wantCode: CodeInvalidGrant,
+			wantMsg:  "Authorization code is expired.",
+			wantLog:  "202401",
+		},
+		{
+			name:     "API error envelope",
+			status:   http.StatusUnauthorized,
+			body:     `{"data":{},"error":{"code":"access_token_invalid","message":"The access token is invalid","log_id":"202402"}}`,
+			wantCode: CodeAccessTokenInvalid,
+			wantMsg:  "The access token is invalid",
+			wantLog:  "202402",
+		},
+		{
+			name:     "OAuth error with status 200",
+			status:   http.StatusOK,
+			body:     `{"error":"invalid_client","error_description":"Client key or secret is incorrect.","log_id":"202403"}`,
+			wantCode: CodeInvalidClient,
+			wantMsg:  "Client key or secret is incorrect.",
+			wantLog:  "202403",
+		},
+		{
+			name:     "API envelope error with status 200",
+			status:   http.StatusOK,
+			body:     `{"data":{},"error":{"code":"scope_not_authorized","message":"missing scope","log_id":"202404"}}`,
+			wantCode: CodeScopeNotAuthorized,
+			wantMsg:  "missing scope",
+			wantLog:  "202404",
+		},
+		{
+			name:     "error status without a TikTok body",
+			status:   http.StatusBadGateway,
+			body:     `<html>bad gateway</html>`,
+			wantCode: CodeHTTPError,
+			wantMsg:  http.StatusText(http.StatusBadGateway),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseError(tt.status, []byte(tt.body))
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("parseError = %v, want *Error", err)
+			}
+			if apiErr.Code != tt.wantCode || apiErr.Message != tt.wantMsg || apiErr.LogID != tt.wantLog {
+				t.Errorf("parseError = %+v, want code %q, message %q, log_id %q", apiErr, tt.wantCode, tt.wantMsg, tt.wantLog)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestParseErrorSuccess(t *testing.T) {
+	bodies := []string{
+		`{"data":{"user":{"open_id":"oid"}},"error":{"code":"ok","message":"","log_id":"202405"}}`,
+		`{"access_token":"act.test","expires_in":86400,"open_id":"oid"}`,
+		``,
+	}
+	for _, body := range bodies {
+		if err := parseError(http.StatusOK, []byte(body)); err != nil {
+			t.Errorf("parseError(%q) = %v, want nil", body, err)
+		}
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		code   string
+		status int
+		want   Kind
+	}{
+		{CodeInvalidGrant, http.StatusBadRequest, KindBadRequest},
+		{CodeInvalidRequest, http.StatusBadRequest, KindBadRequest},
+		{CodeInvalidParams, http.StatusOK, KindBadRequest},
+		{CodeAccessTokenInvalid, http.StatusOK, KindUnauthorized},
+		{CodeScopeNotAuthorized, http.StatusOK, KindForbidden},
+		{CodeAccessDenied, http.StatusBadRequest, KindForbidden},
+		{CodeRateLimitExceeded, http.StatusOK, KindRateLimited},
+		{CodeInvalidClient, http.StatusUnauthorized, KindUpstream},
+		{"something_new", http.StatusOK, KindUpstream},
+		{"something_new", http.StatusTooManyRequests, KindRateLimited},
+		{CodeHTTPError, http.StatusInternalServerError, KindUpstream},
+	}
+	for _, tt := range tests {
+		err := &Error{Code: tt.code, StatusCode: tt.status}
+		if got := err.Kind(); got != tt.want {
+			t.Errorf("Kind(%s, %d) = %d, want %d", tt.code, tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerPolicy controls the per-endpoint circuit breakers of an HTTPClient.
+// Zero fields use the defaults of DefaultBreakerPolicy.
+type BreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit
+	FailureThreshold int
+	// OpenTimeout is how long an open circuit rejects calls before letting probes through
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probe calls in the half-open state; when
+	// all of them succeed the circuit closes, a single failure opens it again
+	HalfOpenRequests int
+}
+
+// DefaultBreakerPolicy returns the policy used when nothing is configured
+func DefaultBreakerPolicy() BreakerPolicy {
+	return BreakerPolicy{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// withDefaults fills zero fields from DefaultBreakerPolicy
+func (p BreakerPolicy) withDefaults() BreakerPolicy {
+	defaults := DefaultBreakerPolicy()
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = defaults.FailureThreshold
+	}
+	if p.OpenTimeout <= 0 {
+		p.OpenTimeout = defaults.OpenTimeout
+	}
+	if p.HalfOpenRequests <= 0 {
+		p.HalfOpenRequests = defaults.HalfOpenRequests
+	}
+	return p
+}
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+// Circuit breaker states
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// ErrCircuitOpen is matched by errors.Is for calls rejected by an open circuit
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError is returned for calls rejected by an open circuit
+type CircuitOpenError struct {
+	Endpoint string
+	// RetryAfter is the remaining time until the circuit lets probe calls through
+	RetryAfter time.Duration
+}
+
+// Error implements error
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s is unavailable, circuit breaker open (retry in %s)", e.Endpoint, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) work
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerStatus describes the circuit breaker of one endpoint
+type BreakerStatus struct {
+	Endpoint string       `json:"endpoint"`
+	State    BreakerState `json:"state"`
+	// Failures is the number of consecutive failures
+	Failures int `json:"failures"`
+	// OpenedAt is when the circuit last opened, 0 if never
+	OpenedAt int64 `json:"opened_at,omitempty"`
+	// Rejected is the number of calls failed fast since the process started
+	Rejected int64 `json:"rejected"`
+}
+
+// breaker is the circuit breaker of one endpoint
+type breaker struct {
+	mu        sync.Mutex
+	policy    BreakerPolicy
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probes    int
+	successes int
+	rejected  int64
+}
+
+// allow reports whether a call may be sent now, or how long the circuit stays open
+func (b *breaker) allow(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		if wait := b.openedAt.Add(b.policy.OpenTimeout).Sub(now); wait > 0 {
+			b.rejected++
+			return false, wait
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.successes = 0
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes+b.successes >= b.policy.HalfOpenRequests {
+			b.rejected++
+			return false, 0
+		}
+		b.probes++
+	}
+	return true, 0
+}
+
+// record updates the breaker with the outcome of an allowed call
+func (b *breaker) record(failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.policy.FailureThreshold {
+			b.open(now)
+		}
+	case BreakerHalfOpen:
+		b.probes = max(b.probes-1, 0)
+		if failed {
+			b.failures++
+			b.open(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.policy.HalfOpenRequests {
+			b.state = BreakerClosed
+			b.failures = 0
+		}
+	}
+}
+
+// release frees a probe slot without an outcome, e.g. when the caller gave up
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probes = max(b.probes-1, 0)
+	}
+}
+
+// open moves the breaker to the open state; the caller holds the lock
+func (b *breaker) open(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+}
+
+// status returns the breaker's state for an endpoint
+func (b *breaker) status(endpoint string) BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		Endpoint: endpoint,
+		State:    b.state,
+		Failures: b.failures,
+		Rejected: b.rejected,
+	}
+	if !b.openedAt.IsZero() {
+		status.OpenedAt = b.openedAt.Unix()
+	}
+	return status
+}
+
+// breakerFailure reports whether an attempt counts against the endpoint's health:
+// network errors, timeouts and 5xx responses. 429 is a quota signal, not an outage.
+func breakerFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// endpointKey identifies an endpoint by scheme, host and path
+func endpointKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// breaker returns the circuit breaker for an endpoint, creating it on first use
+func (c *HTTPClient) breaker(endpoint string) *breaker {
+	c.breakerMu.Lock()
+	defer c.breakerMu.Unlock()
+
+	if c.breakers == nil {
+		c.breakers = make(map[string]*breaker)
+	}
+	b, ok := c.breakers[endpoint]
+	if !ok {
+		b = &breaker{policy: c.Breaker.withDefaults(), state: BreakerClosed}
+		c.breakers[endpoint] = b
+	}
+	return b
+}
+
+// BreakerStatus returns the circuit breakers of all endpoints called so far, sorted by endpoint
+func (c *HTTPClient) BreakerStatus() []BreakerStatus {
+	c.breakerMu.Lock()
+	endpoints := make([]string, 0, len(c.breakers))
+	for endpoint := range c.breakers {
+		endpoints = append(endpoints, endpoint)
+	}
+	c.breakerMu.Unlock()
+
+	sort.Strings(endpoints)
+	statuses := make([]BreakerStatus, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		statuses = append(statuses, c.breaker(endpoint).status(endpoint))
+	}
+	return statuses
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(threshold int, openTimeout time.Duration, halfOpen int) *breaker {
+	return &breaker{
+		policy: BreakerPolicy{FailureThreshold: threshold, OpenTimeout: openTimeout, HalfOpenRequests: halfOpen},
+		state:  BreakerClosed,
+	}
+}
+
+// call runs one allowed call through the breaker and reports whether it was let through
+func call(b *breaker, failed bool, now time.Time) bool {
+	ok, _ := b.allow(now)
+	if ok {
+		b.record(failed, now)
+	}
+	return ok
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b := newTestBreaker(3, time.Minute, 1)
+	now := time.Unix(1_700_000_000, 0)
+
+	call(b, true, now)
+	call(b, true, now)
+	call(b, false, now) // a success resets the count
+	call(b, true, now)
+	call(b, true, now)
+	if b.state != BreakerClosed {
+		t.Fatalf("state %s after non-consecutive failures, want closed", b.state)
+	}
+
+	call(b, true, now)
+	if b.state != BreakerOpen {
+		t.Fatalf("state %s after 3 consecutive failures, want open", b.state)
+	}
+}
+
+func TestOpenBreakerRejectsWithRetryAfter(t *testing.T) {
+	b := newTestBreaker(1, time.Minute, 1)
+	now := time.Unix(1_700_000_000, 0)
+	call(b, true, now)
+
+	ok, wait := b.allow(now.Add(20 * time.Second))
+	if ok {
+		t.Fatal("open breaker let a call through")
+	}
+	if wait != 40*time.Second {
+		t.Errorf("RetryAfter = %s, want 40s", wait)
+	}
+	if status := b.status("e"); status.Rejected != 1 || status.OpenedAt != now.Unix() {
+		t.Errorf("status = %+v, want 1 rejection and opened_at %d", status, now.Unix())
+	}
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	b := newTestBreaker(1, time.Minute, 2)
+	now := time.Unix(1_700_000_000, 0)
+	call(b, true, now)
+
+	later := now.Add(time.Minute)
+	if ok, _ := b.allow(later); !ok {
+		t.Fatal("first probe rejected after open_timeout")
+	}
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("state %s, want half-open", b.state)
+	}
+	if ok, _ := b.allow(later); !ok {
+		t.Fatal("second probe rejected")
+	}
+	if ok, _ := b.allow(later); ok {
+		t.Fatal("third call let through with half_open_requests 2")
+	}
+
+	// Both probes succeed
+	b.record(false, later)
+	if b.state != BreakerHalfOpen {
+		t.Fatalf("state %s after one of two probes, want half-open", b.state)
+	}
+	b.record(false, later)
+	if b.state != BreakerClosed {
+		t.Fatalf("state %s after successful probes, want closed", b.state)
+	}
+	if ok, _ := b.allow(later); !ok {
+		t.Error("closed breaker rejected a call")
+	}
+}
+
+func TestBreakerReopensOnFailedProbe(t *testing.T) {
+	b := newTestBreaker(1, time.Minute, 1)
+	now := time.Unix(1_700_000_000, 0)
+	call(b, true, now)
+
+	probeAt := now.Add(time.Minute)
+	if !call(b, true, probeAt) {
+		t.Fatal("probe rejected")
+	}
+	if b.state != BreakerOpen {
+		t.Fatalf("state %s after a failed probe, want open", b.state)
+	}
+	// The open timeout starts again from the failed probe
+	if ok, wait := b.allow(probeAt.Add(time.Second)); ok || wait != 59*time.Second {
+		t.Errorf("allow = %v, %s, want rejected for 59s", ok, wait)
+	}
+}
+
+func TestBreakerReleaseFreesProbe(t *testing.T) {
+	b := newTestBreaker(1, time.Minute, 1)
+	now := time.Unix(1_700_000_000, 0)
+	call(b, true, now)
+
+	later := now.Add(time.Minute)
+	if ok, _ := b.allow(later); !ok {
+		t.Fatal("probe rejected")
+	}
+	b.release()
+	if ok, _ := b.allow(later); !ok {
+		t.Error("released probe slot not reusable")
+	}
+}
+
+func TestBreakerIgnoresClientErrors(t *testing.T) {
+	server, calls := scriptedServer(t, "", http.StatusBadRequest)
+	client := NewHTTPClient("")
+	client.Retry = RetryPolicy{MaxAttempts: 1}
+	client.Breaker = BreakerPolicy{FailureThreshold: 2, OpenTimeout: time.Minute}
+
+	for i := 0; i < 5; i++ {
+		if status := send(t, client, context.Background(), http.MethodGet, server.URL); status != http.StatusBadRequest {
+			t.Fatalf("status %d, want 400", status)
+		}
+	}
+	if got := calls.Load(); got != 5 {
+		t.Errorf("%d calls reached the server, want 5", got)
+	}
+	for _, status := range client.BreakerStatus() {
+		if status.State != BreakerClosed || status.Failures != 0 {
+			t.Errorf("breaker %+v, want closed without failures", status)
+		}
+	}
+}
+
+func TestOpenCircuitFailsFast(t *testing.T) {
+	server, calls := scriptedServer(t, "", http.StatusBadGateway)
+	client := NewHTTPClient("")
+	client.Retry = RetryPolicy{MaxAttempts: 1}
+	client.Breaker = BreakerPolicy{FailureThreshold: 2, OpenTimeout: time.Minute}
+
+	send(t, client, context.Background(), http.MethodGet, server.URL)
+	send(t, client, context.Background(), http.MethodGet, server.URL)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Do(req)
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want CircuitOpenError", err)
+	}
+	if circuitErr.RetryAfter <= 0 || circuitErr.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %s, want within the open timeout", circuitErr.RetryAfter)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("%d calls reached the server, want 2", got)
+	}
+}
@@ -2,18 +2,28 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
 // HTTPClient wrapper for TikTok API calls
 type HTTPClient struct {
-	Client  *http.Client
-	baseURL string
+	Client *http.Client
+	// Retry is the default retry policy of Do
+	Retry RetryPolicy
+	// Breaker configures the circuit breaker of each endpoint
+	Breaker BreakerPolicy
+
+	baseURL   string
+	retries   retryCounters
+	breakerMu sync.Mutex
+	breakers  map[string]*breaker
 }
 
 // NewHTTPClient creates a new HTTP client
@@ -27,17 +37,17 @@ func NewHTTPClient(baseURL string) *HTTPClient {
 }
 
 // PostForm sends a POST request with form data
-func (c *HTTPClient) PostForm(endpoint string, data url.Values) (*http.Response, error) {
+func (c *HTTPClient) PostForm(ctx context.Context, endpoint string, data url.Values) (*http.Response, error) {
 	url := c.baseURL + endpoint
 
-	req, err := http.NewRequest("POST", url, bytes.NewBufferString(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
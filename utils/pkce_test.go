@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestCodeChallengeS256(t *testing.T) {
+	// RFC 7636, Appendix B
+	if got := CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("CodeChallengeS256 = %q", got)
+	}
+}
+
+func TestGenerateCodeVerifier(t *testing.T) {
+	first, err := GenerateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 43 {
+		t.Errorf("verifier length %d, want 43", len(first))
+	}
+	if first == second {
+		t.Error("two verifiers are equal")
+	}
+}
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy controls how HTTPClient.Do retries transient failures.
+// Zero fields use the defaults of DefaultRetryPolicy; MaxAttempts 1 disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled for every further retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between attempts
+	MaxDelay time.Duration
+	// Deadline bounds all attempts and waits of a call together
+	Deadline time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used when nothing is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		Deadline:    20 * time.Second,
+	}
+}
+
+// withDefaults fills zero fields from DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaults.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaults.MaxDelay
+	}
+	if p.Deadline <= 0 {
+		p.Deadline = defaults.Deadline
+	}
+	return p
+}
+
+// backoff returns the jittered wait before retry number n (1 for the first retry),
+// a random duration in [d/2, d] with d = BaseDelay * 2^(n-1) capped at MaxDelay
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < n && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// RetryStats counts the retries of an HTTPClient
+type RetryStats struct {
+	// Calls is the number of Do calls
+	Calls int64 `json:"calls"`
+	// Retries is the number of attempts after the first one
+	Retries int64 `json:"retries"`
+	// RetryAfter is the number of retries that waited for a Retry-After header
+	RetryAfter int64 `json:"retry_after"`
+	// Exhausted is the number of calls that still failed transiently when attempts or deadline ran out
+	Exhausted int64 `json:"exhausted"`
+}
+
+// retryCounters are the live counters behind RetryStats
+type retryCounters struct {
+	calls      atomic.Int64
+	retries    atomic.Int64
+	retryAfter atomic.Int64
+	exhausted  atomic.Int64
+}
+
+type retryPolicyKey struct{}
+type idempotentKey struct{}
+type beforeAttemptKey struct{}
+
+// WithRetryPolicy overrides the client's retry policy for calls made with the returned context
+func WithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// Idempotent marks calls made with the returned context as safe to repeat, so
+// non-GET requests are retried after any transient failure
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// BeforeAttempt runs hook before every attempt of calls made with the returned context
+// that the circuit breaker lets through, e.g. to account each attempt against a quota.
+// An error from hook ends the call unsent.
+func BeforeAttempt(ctx context.Context, hook func(ctx context.Context) error) context.Context {
+	return context.WithValue(ctx, beforeAttemptKey{}, hook)
+}
+
+// isIdempotent reports whether a request may be sent again after it possibly reached the server
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// retryable reports whether an attempt failed transiently. Requests that are not
+// idempotent are only retried on 429 and 503, where the server did not process them.
+func retryable(resp *http.Response, err error, idempotent bool) bool {
+	if err != nil {
+		return idempotent
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header of 429 and 503 responses, in seconds or as HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// Do sends a request, retrying transient failures with exponential backoff and jitter.
+// The policy comes from WithRetryPolicy on the request context, else from the client.
+// Calls to an endpoint whose circuit breaker is open fail fast with a CircuitOpenError.
+// A request body must be rewindable (GetBody set, as by http.NewRequest) to be retried.
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	policy := c.Retry
+	if override, ok := req.Context().Value(retryPolicyKey{}).(RetryPolicy); ok {
+		policy = override
+	}
+	policy = policy.withDefaults()
+	idempotent := isIdempotent(req)
+	rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	c.retries.calls.Add(1)
+	ctx, cancel := context.WithTimeout(req.Context(), policy.Deadline)
+	endpoint := endpointKey(req.URL)
+	circuit := c.breaker(endpoint)
+	beforeAttempt, _ := req.Context().Value(beforeAttemptKey{}).(func(context.Context) error)
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.WithContext(ctx)
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		if ok, wait := circuit.allow(time.Now()); !ok {
+			cancel()
+			return nil, &CircuitOpenError{Endpoint: endpoint, RetryAfter: wait}
+		}
+		// Only attempts the breaker lets through reach the hook, rejected ones send nothing
+		if beforeAttempt != nil {
+			if err := beforeAttempt(ctx); err != nil {
+				circuit.release()
+				cancel()
+				return nil, err
+			}
+		}
+		resp, err := c.Client.Do(attemptReq)
+		if req.Context().Err() != nil {
+			// The caller gave up, which says nothing about the endpoint
+			circuit.release()
+		} else {
+			circuit.record(breakerFailure(resp, err), time.Now())
+		}
+		if !retryable(resp, err, idempotent) || !rewindable || ctx.Err() != nil {
+			return finish(resp, err, cancel)
+		}
+
+		wait := policy.backoff(attempt)
+		after, hasRetryAfter := retryAfter(resp, time.Now())
+		if hasRetryAfter {
+			wait = after
+		}
+		deadline, _ := ctx.Deadline()
+		if attempt >= policy.MaxAttempts || time.Now().Add(wait).After(deadline) {
+			c.retries.exhausted.Add(1)
+			return finish(resp, err, cancel)
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		c.retries.retries.Add(1)
+		if hasRetryAfter {
+			c.retries.retryAfter.Add(1)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			cancel()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// RetryStats returns the retry counters of the client
+func (c *HTTPClient) RetryStats() RetryStats {
+	return RetryStats{
+		Calls:      c.retries.calls.Load(),
+		Retries:    c.retries.retries.Load(),
+		RetryAfter: c.retries.retryAfter.Load(),
+		Exhausted:  c.retries.exhausted.Load(),
+	}
+}
+
+// finish returns the last attempt's result, keeping the deadline context alive until the body is closed
+func finish(resp *http.Response, err error, cancel context.CancelFunc) (*http.Response, error) {
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose cancels the call's context when the response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
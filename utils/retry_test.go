@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedServer answers each request with the next status, repeating the last one
+func scriptedServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if retryAfter != "" && (status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// testClient returns a client with fast backoff and no breaker interference
+func testClient(policy RetryPolicy) *HTTPClient {
+	client := NewHTTPClient("")
+	client.Retry = policy
+	client.Breaker = BreakerPolicy{FailureThreshold: 100}
+	return client
+}
+
+// send makes a call and returns the final status
+func send(t *testing.T, client *HTTPClient, ctx context.Context, method, url string) int {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader("grant_type=authorization_code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRetryAfterIsHonoured(t *testing.T) {
+	server, calls := scriptedServer(t, "1", http.StatusTooManyRequests, http.StatusOK)
+	client := testClient(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Deadline: 5 * time.Second})
+
+	start := time.Now()
+	if status := send(t, client, context.Background(), http.MethodPost, server.URL); status != http.StatusOK {
+		t.Fatalf("status %d, want 200", status)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %s, want the 1s Retry-After instead of the 1ms backoff", elapsed)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("%d attempts, want 2", got)
+	}
+	if stats := client.RetryStats(); stats.Retries != 1 || stats.RetryAfter != 1 {
+		t.Errorf("stats = %+v, want 1 retry after Retry-After", stats)
+	}
+}
+
+func TestRetryAfterBeyondDeadlineIsNotWaited(t *testing.T) {
+	server, calls := scriptedServer(t, "30", http.StatusTooManyRequests, http.StatusOK)
+	client := testClient(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Deadline: time.Second})
+
+	start := time.Now()
+	if status := send(t, client, context.Background(), http.MethodGet, server.URL); status != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want the 429 returned", status)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("waited %s for a Retry-After past the deadline", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("%d attempts, want 1", got)
+	}
+	if stats := client.RetryStats(); stats.Exhausted != 1 {
+		t.Errorf("stats = %+v, want the call counted as exhausted", stats)
+	}
+}
+
+func TestServerErrorsRetriedOnlyWhenIdempotent(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	tests := []struct {
+		name   string
+		method string
+		ctx    context.Context
+		status int
+		want   int32
+	}{
+		{"GET 500", http.MethodGet, context.Background(), http.StatusInternalServerError, 3},
+		{"idempotent POST 500", http.MethodPost, Idempotent(context.Background()), http.StatusInternalServerError, 3},
+		{"code exchange 500", http.MethodPost, context.Background(), http.StatusInternalServerError, 1},
+		{"code exchange 502", http.MethodPost, context.Background(), http.StatusBadGateway, 1},
+		{"code exchange 503", http.MethodPost, context.Background(), http.StatusServiceUnavailable, 3},
+		{"GET 400", http.MethodGet, context.Background(), http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := scriptedServer(t, "", tt.status)
+			client := testClient(policy)
+
+			send(t, client, tt.ctx, tt.method, server.URL)
+			if got := calls.Load(); got != tt.want {
+				t.Errorf("%d attempts, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxAttemptsIsRespected(t *testing.T) {
+	for _, maxAttempts := range []int{1, 2, 4} {
+		server, calls := scriptedServer(t, "", http.StatusServiceUnavailable)
+		client := testClient(RetryPolicy{MaxAttempts: maxAttempts, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+		if status := send(t, client, context.Background(), http.MethodGet, server.URL); status != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, want 503", status)
+		}
+		if got := calls.Load(); got != int32(maxAttempts) {
+			t.Errorf("MaxAttempts %d: %d attempts", maxAttempts, got)
+		}
+		stats := client.RetryStats()
+		if stats.Calls != 1 || stats.Retries != int64(maxAttempts-1) || stats.Exhausted != 1 {
+			t.Errorf("MaxAttempts %d: stats = %+v", maxAttempts, stats)
+		}
+	}
+}
+
+func TestRetryPolicyOverride(t *testing.T) {
+	server, calls := scriptedServer(t, "", http.StatusServiceUnavailable)
+	client := testClient(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	ctx := WithRetryPolicy(context.Background(), RetryPolicy{MaxAttempts: 1})
+	send(t, client, ctx, http.MethodGet, server.URL)
+	if got := calls.Load(); got != 1 {
+		t.Errorf("%d attempts, want 1 from the override", got)
+	}
+}
+
+func TestBackoffGrowsAndIsCapped(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := policy.backoff(tt.retry); got < tt.min || got > tt.max {
+				t.Errorf("backoff(%d) = %s, want within [%s, %s]", tt.retry, got, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryAfterParsing(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		status int
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{http.StatusTooManyRequests, "5", 5 * time.Second, true},
+		{http.StatusServiceUnavailable, now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second, true},
+		{http.StatusTooManyRequests, now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{http.StatusTooManyRequests, "soon", 0, false},
+		{http.StatusInternalServerError, "5", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{"Retry-After": {tt.header}}}
+		got, ok := retryAfter(resp, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%d, %q) = %s, %v, want %s, %v", tt.status, tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}